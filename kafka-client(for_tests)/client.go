@@ -75,21 +75,23 @@ func randomString() string {
 }
 
 func randomPhone() string {
-	return fmt.Sprintf("+%d%d", rand.Intn(99), rand.Intn(1000000000))
+	return fmt.Sprintf("+%d%09d", 1+rand.Intn(98), rand.Intn(1000000000))
 }
 
 func generateRandomItems(trackNumber string, num int) []Item {
 	items := make([]Item, num)
 	for i := 0; i < num; i++ {
+		price := rand.Intn(1000)
+		sale := rand.Intn(90)
 		items[i] = Item{
-			ChrtID:      rand.Intn(10000000),
+			ChrtID:      1 + rand.Intn(10000000),
 			TrackNumber: trackNumber,
-			Price:       rand.Intn(1000),
+			Price:       price,
 			RID:         randomString(),
 			Name:        fmt.Sprintf("Test Item %d", i+1),
-			Sale:        rand.Intn(90),
+			Sale:        sale,
 			Size:        "0",
-			TotalPrice:  rand.Intn(1000),
+			TotalPrice:  price * (100 - sale) / 100,
 			NmID:        rand.Intn(1000000),
 			Brand:       "Test Brand",
 			Status:      rand.Intn(400),
@@ -103,6 +105,13 @@ func generateRandomOrder() Order {
 
 	trackNumber := fmt.Sprintf("TRACK%d", rand.Intn(1000000))
 
+	items := generateRandomItems(trackNumber, numItems)
+	goodsTotal := 0
+	for _, item := range items {
+		goodsTotal += item.TotalPrice
+	}
+	deliveryCost := rand.Intn(2000)
+
 	order := Order{
 		OrderUID:    randomString(),
 		TrackNumber: trackNumber,
@@ -121,13 +130,13 @@ func generateRandomOrder() Order {
 			Transaction:  randomString(),
 			Currency:     "USD",
 			Provider:     "wbpay",
-			Amount:       rand.Intn(10000),
+			Amount:       goodsTotal + deliveryCost,
 			PaymentDt:    int(time.Now().Unix()),
 			Bank:         "alpha",
-			DeliveryCost: rand.Intn(2000),
-			GoodsTotal:   rand.Intn(5000),
+			DeliveryCost: deliveryCost,
+			GoodsTotal:   goodsTotal,
 		},
-		Items:           generateRandomItems(trackNumber, numItems),
+		Items:           items,
 		Locale:          "en",
 		CustomerID:      fmt.Sprintf("customer%d", rand.Intn(1000)),
 		DeliveryService: "meest",
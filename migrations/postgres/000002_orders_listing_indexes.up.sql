@@ -0,0 +1,3 @@
+CREATE INDEX IF NOT EXISTS orders_date_created_order_uid_idx ON orders (date_created DESC, order_uid DESC);
+CREATE INDEX IF NOT EXISTS orders_customer_id_idx ON orders (customer_id);
+CREATE INDEX IF NOT EXISTS orders_track_number_idx ON orders (track_number);
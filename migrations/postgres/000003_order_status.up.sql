@@ -0,0 +1,2 @@
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'created'
+    CHECK (status IN ('created', 'paid', 'shipped', 'delivered', 'cancelled'));
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 	"os"
 	"os/signal"
@@ -9,50 +10,150 @@ import (
 	"time"
 
 	kafka_subscriber "github.com/Util787/order-base/internal/adapters/kafka-subscriber"
+	outbox_relay "github.com/Util787/order-base/internal/adapters/outbox-relay"
 	"github.com/Util787/order-base/internal/adapters/rest"
-	"github.com/Util787/order-base/internal/common"
+	"github.com/Util787/order-base/internal/codec"
 	"github.com/Util787/order-base/internal/config"
 	"github.com/Util787/order-base/internal/infra/storage"
 	"github.com/Util787/order-base/internal/logger/slogpretty"
+	"github.com/Util787/order-base/internal/metrics"
+	"github.com/Util787/order-base/internal/models"
+	"github.com/Util787/order-base/internal/redact"
+	"github.com/Util787/order-base/internal/tracing"
 	"github.com/Util787/order-base/internal/usecase"
 )
 
 // kafka vars
 const (
-	numFetchers    = 2
 	numHandlers    = 2
 	messageChanBuf = 100
 )
 
-// in-memory storage vars
-var (
-	loadLimit       uint64 = 100
-	cleanUpInterval        = time.Minute
-)
-
 func main() {
 	cfg := config.MustLoadConfig()
 
 	// for now I think using logger only in adapters and usecase layers will be enough
-	log := setupLogger(cfg.Env)
+	log := setupLogger(cfg.Env, redact.NewPolicy(models.Order{}))
+
+	shutdownTracer := tracing.MustInitTracer(context.Background(), cfg.TracingConfig)
 
 	// storages
 	postgreStorage := storage.MustInitPostgres(context.Background(), cfg.PostgresConfig)
 
-	inMemoryStorage := storage.NewInMemoryStorage(context.Background(), 100, cleanUpInterval) // inMemoryStorage is pointer
-	inMemoryStorage.LoadOrders(context.Background(), &postgreStorage, &loadLimit, &common.DefaultTTL)
+	inMemoryOpts := []storage.InMemoryOption{
+		storage.WithMaxEntries(cfg.CacheConfig.MaxEntries),
+		storage.WithMaxBytes(cfg.CacheConfig.MaxBytes),
+		storage.WithShards(cfg.CacheConfig.Shards),
+		storage.WithStaleTTL(cfg.CacheConfig.StaleTTL),
+	}
+	if cfg.CacheConfig.Expiry == config.CacheExpirySliding {
+		// local copies of tiered backend must expire to pick up changes made by other replicas
+		if cfg.CacheConfig.Backend == config.CacheBackendMemory {
+			inMemoryOpts = append(inMemoryOpts, storage.WithSlidingExpiry())
+		} else {
+			log.Warn("Sliding cache expiry is supported only by memory cache backend, absolute expiry is used")
+		}
+	}
+
+	// in-memory cache is not read with redis backend, so it is neither warmed up nor reported
+	inMemoryUsed := cfg.CacheConfig.Backend != config.CacheBackendRedis
+	warmUpCfg := cfg.CacheConfig.CacheWarmUpConfig
+	if !inMemoryUsed && warmUpCfg.Strategy != config.CacheWarmUpNone {
+		log.Warn("Cache warm-up is supported only by memory and tiered cache backends, it is skipped")
+		warmUpCfg.Strategy = config.CacheWarmUpNone
+	}
+	if cfg.CacheConfig.Backend == config.CacheBackendTiered {
+		// warmed up local copies must expire as fast as the rest of them
+		warmUpCfg.TTL = min(warmUpCfg.TTL, cfg.CacheConfig.LocalTTL)
+	}
+
+	// cache ctx stops both clean up and warm-up
+	cacheCtx, stopCacheCleanUp := context.WithCancel(context.Background())
+	inMemoryStorage := storage.NewInMemoryStorage(cacheCtx, int(warmUpCfg.Size), cfg.CacheConfig.CleanUpInterval, inMemoryOpts...) // inMemoryStorage is pointer
+	if warmUpCfg.Strategy != config.CacheWarmUpNone {
+		go warmUpCache(cacheCtx, log, inMemoryStorage, &postgreStorage, warmUpCfg)
+	}
+
+	var cacheStorage usecase.CacheStorage = inMemoryStorage
+	var cacheAdmin rest.CacheAdmin = inMemoryStorage // admin must invalidate the same cache orders are read from, nil for redis backend
+	var redisStorage *storage.RedisStorage
+	if cfg.CacheConfig.Backend != config.CacheBackendMemory {
+		redis := storage.MustInitRedis(context.Background(), cfg.RedisConfig)
+		redisStorage = &redis
+
+		cacheStorage = redisStorage
+		cacheAdmin = nil
+		if cfg.CacheConfig.Backend == config.CacheBackendTiered {
+			tieredStorage := storage.NewTieredStorage(inMemoryStorage, redisStorage, cfg.CacheConfig.LocalTTL)
+			cacheStorage = &tieredStorage
+			cacheAdmin = &tieredStorage
+		}
+	}
+	log.Info("Cache backend", slog.String("backend", cfg.CacheConfig.Backend))
 
 	// usecases
-	orderUsecase := usecase.NewOrderUsecase(log, &postgreStorage, inMemoryStorage)
+	usecaseOpts := []usecase.OrderUsecaseOption{usecase.WithNegativeCaching(cfg.CacheConfig.NegativeTTL)}
+	if cfg.CacheConfig.StaleTTL > 0 {
+		usecaseOpts = append(usecaseOpts, usecase.WithStaleWhileRevalidate())
+	}
+	orderUsecase := usecase.NewOrderUsecase(log, &postgreStorage, cacheStorage, cfg.CacheConfig.TTL, usecaseOpts...)
 
 	// kafka
-	kafkaSub := kafka_subscriber.NewKafkaSubscriber(log, cfg.KafkaConfig, &orderUsecase, messageChanBuf)
+	// avro schemas are served by the local schema registry stand-in
+	orderDecoder, err := codec.NewOrderDecoder(cfg.KafkaConfig.ContentType, cfg.KafkaConfig.StrictJSON, codec.LocalSchemaRegistry{})
+	if err != nil {
+		panic("Invalid kafka content type: " + err.Error())
+	}
+	kafkaSub := kafka_subscriber.NewKafkaSubscriber(log, cfg.KafkaConfig, &orderUsecase, orderDecoder, messageChanBuf)
+
+	var relay *outbox_relay.OutboxRelay
+	if cfg.KafkaOutboxConfig.Topic != "" {
+		relay = outbox_relay.NewOutboxRelay(log, cfg.KafkaConfig.Brokers, cfg.KafkaOutboxConfig, &postgreStorage)
+	} else {
+		log.Warn("Outbox topic is not set, order events are not published")
+	}
+
+	// metrics
+	metrics.RegisterPostgresPool(postgreStorage.Stat)
+	if inMemoryUsed {
+		metrics.RegisterInMemoryCache(inMemoryStorage.Stats)
+	}
+	metrics.RegisterKafkaReader(kafkaSub.Stats)
 
 	// rest
-	serv := rest.NewHTTPServer(log, cfg.Env, cfg.HTTPServerConfig, &orderUsecase)
+	dependencyChecks := []rest.DependencyCheck{
+		{Name: "postgres", Check: postgreStorage.Ping},
+		{Name: "kafka", Check: kafkaSub.Ping},
+	}
+	if warmUpCfg.Strategy != config.CacheWarmUpNone {
+		dependencyChecks = append(dependencyChecks, rest.DependencyCheck{Name: "cache_warm_up", Check: func(context.Context) error {
+			if !inMemoryStorage.WarmedUp() {
+				return fmt.Errorf("%w: %d orders loaded", rest.ErrNotReady, inMemoryStorage.WarmUpLoaded())
+			}
+			return nil
+		}})
+	}
+	if redisStorage != nil {
+		dependencyChecks = append(dependencyChecks, rest.DependencyCheck{Name: "redis", Check: redisStorage.Ping})
+	}
+	cacheWarmUp := func(ctx context.Context, limit uint64) error {
+		_, err := inMemoryStorage.WarmUp(ctx, &postgreStorage, storage.WarmUpOptions{Limit: limit, TTL: &warmUpCfg.TTL})
+		return err
+	}
+	authenticators, err := rest.NewAuthenticators(cfg.HTTPServerConfig.AuthConfig)
+	if err != nil {
+		panic("Invalid auth config: " + err.Error())
+	}
+	if len(authenticators) == 0 {
+		log.Warn("Authentication is disabled, orders are available to everyone and admin routes are disabled")
+	}
+	serv := rest.NewHTTPServer(log, cfg.Env, cfg.HTTPServerConfig, &orderUsecase, dependencyChecks, cacheAdmin, cacheWarmUp, authenticators)
 
 	// start
-	go kafkaSub.Subscribe(context.Background(), numFetchers, numHandlers)
+	kafkaSub.Subscribe(context.Background(), numHandlers)
+	if relay != nil {
+		relay.Run(context.Background())
+	}
 
 	go func() {
 		log.Info("HTTP server start", slog.String("host", cfg.HTTPServerConfig.Host), slog.Int("port", cfg.HTTPServerConfig.Port))
@@ -62,31 +163,82 @@ func main() {
 	}()
 
 	//graceful shutdown
-	shutDownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
-	defer cancel()
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGTERM, syscall.SIGINT)
 
 	<-quit
 	log.Info("Shutting down gracefully...")
 
+	// timeout starts only after the signal is received
+	shutDownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
 	log.Info("Shutting down server")
 	if err := serv.Shutdown(shutDownCtx); err != nil {
 		log.Error("HTTP server shutdown error", slog.String("error", err.Error()))
 	}
 
 	log.Info("Shutting down kafka subscriber")
-	if err := kafkaSub.Shutdown(); err != nil {
+	if err := kafkaSub.Shutdown(shutDownCtx); err != nil {
 		log.Error("Kafka subscriber shutdown error", slog.String("error", err.Error()))
 	}
 
+	if relay != nil {
+		log.Info("Shutting down outbox relay")
+		if err := relay.Shutdown(shutDownCtx); err != nil {
+			log.Error("Outbox relay shutdown error", slog.String("error", err.Error()))
+		}
+	}
+
+	log.Info("Stopping cache clean up")
+	stopCacheCleanUp()
+
 	log.Info("Shutting down postgres")
 	postgreStorage.Shutdown()
 
+	if redisStorage != nil {
+		log.Info("Shutting down redis")
+		if err := redisStorage.Shutdown(); err != nil {
+			log.Error("Redis shutdown error", slog.String("error", err.Error()))
+		}
+	}
+
+	log.Info("Shutting down tracer")
+	if err := shutdownTracer(shutDownCtx); err != nil {
+		log.Error("Tracer shutdown error", slog.String("error", err.Error()))
+	}
+
 	log.Info("Shutdown complete")
 }
 
-func setupLogger(env string) *slog.Logger {
+// warmUpCache loads orders chosen by the warm-up strategy into the in-memory cache, it is run in background
+// and its progress is logged and reported by the readiness check
+func warmUpCache(ctx context.Context, log *slog.Logger, inMemoryStorage *storage.InMemoryStorage, orderLister storage.OrderLister, cfg config.CacheWarmUpConfig) {
+	opts := storage.WarmUpOptions{
+		Limit: cfg.Size,
+		TTL:   &cfg.TTL,
+		Progress: func(loaded int) {
+			log.Info("Cache warm-up progress", slog.Int("loaded", loaded))
+		},
+	}
+	if cfg.Strategy == config.CacheWarmUpPeriod {
+		createdFrom := time.Now().Add(-cfg.Period)
+		opts.CreatedFrom = &createdFrom
+	}
+
+	log.Info("Cache warm-up start", slog.String("strategy", cfg.Strategy))
+	start := time.Now()
+
+	loaded, err := inMemoryStorage.WarmUp(ctx, orderLister, opts)
+	if err != nil {
+		log.Warn("Failed to warm up cache", slog.Int("loaded", loaded), slog.String("error", err.Error()))
+		return
+	}
+	log.Info("Cache warmed up", slog.Int("loaded", loaded), slog.Duration("duration", time.Since(start)))
+}
+
+// personal data is masked in logs of all envs, policy defines which fields of logged json payloads are masked
+func setupLogger(env string, policy *redact.Policy) *slog.Logger {
 	var log *slog.Logger
 
 	switch env {
@@ -102,5 +254,5 @@ func setupLogger(env string) *slog.Logger {
 		)
 	}
 
-	return log
+	return slog.New(redact.NewHandler(log.Handler(), policy))
 }
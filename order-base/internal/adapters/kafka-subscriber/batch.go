@@ -0,0 +1,162 @@
+package kafka_subscriber
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/Util787/order-base/internal/common"
+	"github.com/Util787/order-base/internal/metrics"
+	"github.com/Util787/order-base/internal/models"
+	"github.com/Util787/order-base/internal/tracing"
+	"github.com/google/uuid"
+	"github.com/segmentio/kafka-go"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const defaultBatchTimeout = 100 * time.Millisecond
+
+// saveOrdersBatchHandler collects messages into batches of batchSize, batch is flushed earlier if batchTimeout passed since its first message.
+//
+// Collected batch is flushed when messageCh is closed and drained, but left uncommitted when ctx is done
+func (k *KafkaSubscriber) saveOrdersBatchHandler(ctx context.Context, messageCh <-chan message) {
+	gate := newPartitionGate()
+	batch := make([]message, 0, k.batchSize)
+	var flushTimer <-chan time.Time // nil while batch is empty
+
+	flush := func() {
+		k.handleBatch(ctx, gate, batch)
+		batch = batch[:0]
+		flushTimer = nil
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-flushTimer:
+			flush()
+		case msg, ok := <-messageCh:
+			if !ok {
+				if len(batch) > 0 {
+					flush()
+				}
+				return
+			}
+			if !gate.allow(msg.content) {
+				continue
+			}
+
+			batch = append(batch, msg)
+			if len(batch) == 1 {
+				flushTimer = time.After(k.batchTimeout)
+			}
+			if len(batch) >= k.batchSize {
+				flush()
+			}
+		}
+	}
+}
+
+// handleBatch saves all orders of the batch in one transaction and commits the batch only after it is saved.
+//
+// If any message of the batch can not be handled then the whole batch is handled one by one, so the broken message is dead-lettered and the rest are saved
+func (k *KafkaSubscriber) handleBatch(ctx context.Context, gate *partitionGate, batch []message) {
+	op := common.GetOperationName()
+	start := time.Now()
+
+	// span can have only one parent, so traces of producers are linked instead
+	links := make([]trace.Link, 0, len(batch))
+	for _, msg := range batch {
+		if msg.spanCtx.IsValid() {
+			links = append(links, trace.Link{SpanContext: msg.spanCtx})
+		}
+	}
+	ctx, span := tracer.Start(ctx, "kafka.consume_batch "+k.topic,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithLinks(links...),
+		trace.WithAttributes(
+			semconv.MessagingSystemKafka,
+			semconv.MessagingDestinationName(k.topic),
+			semconv.MessagingBatchMessageCount(len(batch)),
+		),
+	)
+	defer span.End()
+
+	log := common.LogOpAndId(ctx, op, k.log).With(slog.String("batch_id", uuid.NewString()), slog.Int("batch_size", len(batch)))
+	log.Info("start handling batch", slog.Time("start", start))
+	metrics.KafkaBatchSize.Observe(float64(len(batch)))
+
+	orders := make([]models.Order, 0, len(batch))
+	for _, msg := range batch {
+		order, err := k.decodeOrder(msg)
+		if err != nil {
+			log.Warn("failed to decode order, falling back to per-message handling", slog.String("message_id", msg.UID), slog.String("error", err.Error()))
+			tracing.RecordError(span, err)
+			k.handleOneByOne(ctx, gate, batch)
+			return
+		}
+		orders = append(orders, order)
+	}
+
+	attempts, err := k.saveOrdersWithRetry(ctx, log, orders)
+	if err != nil {
+		tracing.RecordError(span, err)
+		if ctx.Err() != nil {
+			// batch is left uncommitted so it will be redelivered
+			log.Error("failed to save batch", slog.String("error", err.Error()), slog.Int("attempts", attempts))
+			observeBatchDuration(metrics.KafkaResultFailed, len(batch), start)
+			return
+		}
+		log.Warn("failed to save batch, falling back to per-message handling", slog.String("error", err.Error()), slog.Int("attempts", attempts))
+		k.handleOneByOne(ctx, gate, batch)
+		return
+	}
+
+	metrics.KafkaMessagesTotal.WithLabelValues(metrics.KafkaResultSaved).Add(float64(len(batch)))
+	observeBatchDuration(metrics.KafkaResultSaved, len(batch), start)
+
+	if err := k.kafkaReader.CommitMessages(ctx, highestOffsets(batch)...); err != nil {
+		log.Error("failed to commit batch", slog.String("error", err.Error()))
+	} else {
+		log.Debug("batch saved successfully", slog.Int64("duration", time.Since(start).Milliseconds()))
+	}
+}
+
+// handleOneByOne handles messages of the batch in the order they were fetched, failed messages are retried the same way as in saveOrderHandler
+func (k *KafkaSubscriber) handleOneByOne(ctx context.Context, gate *partitionGate, batch []message) {
+	for _, msg := range batch {
+		if ctx.Err() != nil {
+			return
+		}
+		if !gate.allow(msg.content) {
+			continue
+		}
+		if !k.handleMessageUntilDone(ctx, msg) {
+			gate.block(k.log, msg.content)
+		}
+	}
+}
+
+// observeBatchDuration observes duration of the batch for every its message, messages handled one by one are observed by handleMessage
+func observeBatchDuration(result string, size int, start time.Time) {
+	duration := time.Since(start).Seconds()
+	observer := metrics.KafkaHandleDuration.WithLabelValues(result)
+	for range size {
+		observer.Observe(duration)
+	}
+}
+
+// highestOffsets returns the message with the highest offset of every partition, committing it commits all previous offsets of the partition too
+func highestOffsets(batch []message) []kafka.Message {
+	highest := make(map[int]kafka.Message)
+	for _, msg := range batch {
+		if current, ok := highest[msg.content.Partition]; !ok || msg.content.Offset > current.Offset {
+			highest[msg.content.Partition] = *msg.content
+		}
+	}
+	return slices.Collect(maps.Values(highest))
+}
@@ -0,0 +1,94 @@
+package kafka_subscriber
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+
+	"github.com/Util787/order-base/internal/common"
+	"github.com/Util787/order-base/internal/metrics"
+	"github.com/Util787/order-base/internal/models"
+	"github.com/Util787/order-base/internal/tracing"
+	"github.com/segmentio/kafka-go"
+)
+
+// dead-letter failure reasons
+const (
+	dlqReasonUnmarshal         = "unmarshal_failed"
+	dlqReasonUnsupportedSchema = "unsupported_schema" // unknown content type or schema version
+	dlqReasonSave              = "save_failed"
+	dlqReasonRetriesExhausted  = "retries_exhausted"
+)
+
+// dead-letter headers
+const (
+	dlqHeaderReason            = "dlq-reason"
+	dlqHeaderError             = "dlq-error"
+	dlqHeaderOriginalTopic     = "dlq-original-topic"
+	dlqHeaderOriginalPartition = "dlq-original-partition"
+	dlqHeaderOriginalOffset    = "dlq-original-offset"
+	dlqHeaderAttempts          = "dlq-attempts"
+)
+
+func newDLQWriter(brokers []string, topic string) *kafka.Writer {
+	return &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{}, // keep messages with the same key in the same partition
+		RequiredAcks: kafka.RequireAll,
+	}
+}
+
+// deadLetter republishes msg to the dead-letter topic with failure details in headers and commits the original offset.
+// If dead-letter topic is not configured then msg is dropped: failure is logged and the original offset is committed.
+//
+// It returns transient error only if publishing fails, then msg is left uncommitted.
+func (k *KafkaSubscriber) deadLetter(ctx context.Context, log *slog.Logger, msg message, reason string, cause error, attempts int) error {
+	op := common.GetOperationName()
+
+	if k.dlqWriter == nil {
+		// leaving msg uncommitted would stop its partition forever
+		metrics.KafkaMessagesTotal.WithLabelValues(metrics.KafkaResultDropped).Inc()
+		log.Error("dead-letter topic is not configured, message is dropped", slog.String("reason", reason), slog.String("error", cause.Error()),
+			slog.Int("partition", msg.content.Partition), slog.Int64("offset", msg.content.Offset))
+		k.commitDeadLetter(ctx, log, msg)
+		return nil
+	}
+
+	headers := make([]kafka.Header, 0, len(msg.content.Headers)+6)
+	headers = append(headers, msg.content.Headers...)
+	headers = append(headers,
+		kafka.Header{Key: dlqHeaderReason, Value: []byte(reason)},
+		kafka.Header{Key: dlqHeaderError, Value: []byte(cause.Error())},
+		kafka.Header{Key: dlqHeaderOriginalTopic, Value: []byte(msg.content.Topic)},
+		kafka.Header{Key: dlqHeaderOriginalPartition, Value: []byte(strconv.Itoa(msg.content.Partition))},
+		kafka.Header{Key: dlqHeaderOriginalOffset, Value: []byte(strconv.FormatInt(msg.content.Offset, 10))},
+		kafka.Header{Key: dlqHeaderAttempts, Value: []byte(strconv.Itoa(attempts))},
+	)
+
+	err := k.dlqWriter.WriteMessages(ctx, kafka.Message{
+		Key:     msg.content.Key,
+		Value:   msg.content.Value,
+		Headers: tracing.InjectIntoKafkaHeaders(ctx, headers),
+	})
+	if err != nil {
+		err = fmt.Errorf("%s: %w: failed to publish message to dead-letter topic: %w", op, models.ErrTransient, err)
+		log.Error("failed to publish message to dead-letter topic", slog.String("error", err.Error()))
+		return err
+	}
+
+	metrics.KafkaMessagesTotal.WithLabelValues(metrics.KafkaResultDeadLettered).Inc()
+	log.Warn("message moved to dead-letter topic", slog.String("reason", reason), slog.Int("partition", msg.content.Partition), slog.Int64("offset", msg.content.Offset))
+
+	k.commitDeadLetter(ctx, log, msg)
+	return nil
+}
+
+// commitDeadLetter commits the offset of dead-lettered or dropped msg, later offsets can be committed over it even if commit fails
+func (k *KafkaSubscriber) commitDeadLetter(ctx context.Context, log *slog.Logger, msg message) {
+	if err := k.kafkaReader.CommitMessages(ctx, *msg.content); err != nil {
+		log.Error("failed to commit dead-lettered message", slog.String("error", err.Error()),
+			slog.Int("partition", msg.content.Partition), slog.Int64("offset", msg.content.Offset))
+	}
+}
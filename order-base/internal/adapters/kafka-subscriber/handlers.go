@@ -2,19 +2,39 @@ package kafka_subscriber
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/Util787/order-base/internal/common"
+	"github.com/Util787/order-base/internal/metrics"
 	"github.com/Util787/order-base/internal/models"
+	"github.com/Util787/order-base/internal/tracing"
 	"github.com/google/uuid"
 	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
+const fetchErrorBackoff = time.Second
+
+// headers describing the message payload, if they are missing then default content type and the current schema version are used
+const (
+	contentTypeHeader   = "content-type"
+	schemaVersionHeader = "schema-version"
+)
+
+var tracer = tracing.Tracer("github.com/Util787/order-base/internal/adapters/kafka-subscriber")
+
 type message struct {
 	content *kafka.Message
 	UID     string
+	spanCtx trace.SpanContext // propagated by the producer, invalid if message has no trace headers
 }
 
 func (k *KafkaSubscriber) fetcher(ctx context.Context) {
@@ -23,53 +43,217 @@ func (k *KafkaSubscriber) fetcher(ctx context.Context) {
 	for {
 		kafkaMsg, err := k.kafkaReader.FetchMessage(ctx)
 		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, io.EOF) { // io.EOF means reader is closed
+				log.Debug("fetcher stopped")
+				return
+			}
 			log.Error("failed to fetch message from Kafka", slog.String("error", err.Error()))
+			k.readerHealth.setErr(err)
+
+			// prevents spinning while broker is unavailable
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(fetchErrorBackoff):
+			}
 			continue
 		}
 
+		k.readerHealth.fetched()
+		metrics.KafkaMessagesTotal.WithLabelValues(metrics.KafkaResultFetched).Inc()
 		msgUID := uuid.NewString()
 
 		log := log.With(slog.String("message_id", msgUID))
 		log.Debug("fetching message from Kafka", slog.Any("message", kafkaMsg))
 
-		k.messageCh <- message{
+		msg := message{
 			content: &kafkaMsg,
 			UID:     msgUID,
+			spanCtx: tracing.ExtractFromKafkaHeaders(kafkaMsg.Headers),
+		}
+
+		select {
+		case k.handlerCh(&kafkaMsg) <- msg:
+		case <-ctx.Done():
+			// message is left uncommitted so it will be redelivered
+			return
 		}
 	}
 }
 
-func (k *KafkaSubscriber) saveOrderHandler(ctx context.Context) {
-	op := common.GetOperationName()
+// saveOrderHandler handles messages one by one, it exits when messageCh is closed and drained or when ctx is done
+func (k *KafkaSubscriber) saveOrderHandler(ctx context.Context, messageCh <-chan message) {
+	gate := newPartitionGate()
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case msg := <-k.messageCh:
-			start := time.Now()
-			ctx = context.WithValue(ctx, common.ContextKey("message_id"), msg.UID)
-			log := common.LogOpAndId(ctx, op, k.log)
-			log.Info("start handling message", slog.Time("start", start))
-
-			var order models.Order
-			err := json.Unmarshal(msg.content.Value, &order)
-			if err != nil {
-				log.Error("failed to unmarshal order", slog.String("error", err.Error()))
-				continue
+		case msg, ok := <-messageCh:
+			if !ok {
+				return
 			}
-
-			err = k.orderUsecase.SaveOrder(ctx, order)
-			if err != nil {
-				log.Error("failed to save order", slog.String("error", err.Error()))
+			if !gate.allow(msg.content) {
 				continue
 			}
+			if !k.handleMessageUntilDone(ctx, msg) {
+				gate.block(k.log, msg.content)
+			}
+		}
+	}
+}
+
+// handleMessageUntilDone retries msg with backoff while it fails with transient errors (e.g. postgres or dead-letter topic is unavailable),
+// later messages of its partition can not be committed before it, so there is no point in handling them meanwhile.
+// Permanent failures are not retried, such messages are dead-lettered or dropped by handleMessage.
+//
+// It returns false if msg is left uncommitted
+func (k *KafkaSubscriber) handleMessageUntilDone(ctx context.Context, msg message) bool {
+	err := k.handleMessage(ctx, msg)
+	if err == nil {
+		return true
+	}
+	if !isRetryable(err) || ctx.Err() != nil {
+		return false
+	}
 
-			if err := k.kafkaReader.CommitMessages(ctx, *msg.content); err != nil {
-				log.Error("failed to commit message", slog.String("error", err.Error()))
-			} else {
-				log.Debug("order saved successfully", slog.String("order_id", order.OrderUID), slog.Int64("duration", time.Since(start).Milliseconds()))
+	metrics.KafkaBlockedPartitions.Inc()
+	defer metrics.KafkaBlockedPartitions.Dec()
+
+	for attempt := 1; ; attempt++ {
+		delay := k.retryPolicy.backoff(attempt)
+		k.log.Warn("message is left uncommitted, partition is blocked until it is handled",
+			slog.Int("partition", msg.content.Partition), slog.Int64("offset", msg.content.Offset), slog.Int("attempt", attempt),
+			slog.Duration("backoff", delay), slog.String("error", err.Error()))
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return false
+		case <-timer.C:
+		}
+
+		err = k.handleMessage(ctx, msg)
+		if err == nil {
+			k.log.Info("blocked message is handled, partition is unblocked",
+				slog.Int("partition", msg.content.Partition), slog.Int64("offset", msg.content.Offset))
+			return true
+		}
+		if !isRetryable(err) || ctx.Err() != nil {
+			return false
+		}
+	}
+}
+
+// handleMessage returns error if msg was neither saved, dead-lettered nor dropped, so offsets after it must not be committed.
+// The error is transient if handling may succeed on retry
+func (k *KafkaSubscriber) handleMessage(ctx context.Context, msg message) error {
+	op := common.GetOperationName()
+	start := time.Now()
+
+	// span continues the trace of the producer if it was propagated in headers
+	ctx = trace.ContextWithRemoteSpanContext(ctx, msg.spanCtx)
+	ctx, span := tracer.Start(ctx, "kafka.consume "+msg.content.Topic,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKafka,
+			semconv.MessagingDestinationName(msg.content.Topic),
+			semconv.MessagingDestinationPartitionID(strconv.Itoa(msg.content.Partition)),
+			semconv.MessagingKafkaOffset(int(msg.content.Offset)),
+			attribute.String("message_id", msg.UID),
+		),
+	)
+	defer span.End()
+
+	ctx = context.WithValue(ctx, common.ContextKey("message_id"), msg.UID)
+	log := common.LogOpAndId(ctx, op, k.log)
+	log.Info("start handling message", slog.Time("start", start))
+
+	result := metrics.KafkaResultFailed
+	defer func() {
+		metrics.KafkaHandleDuration.WithLabelValues(result).Observe(time.Since(start).Seconds())
+	}()
+
+	order, err := k.decodeOrder(msg)
+	if err != nil {
+		log.Error("failed to decode order", slog.String("error", err.Error()))
+		tracing.RecordError(span, err)
+		metrics.KafkaMessagesTotal.WithLabelValues(metrics.KafkaResultFailed).Inc()
+		err = k.deadLetter(ctx, log, msg, decodeFailureReason(err), err, 1)
+		result = k.deadLetterResult(err)
+		return err
+	}
+
+	attempts, err := k.saveOrderWithRetry(ctx, log, order)
+	if err != nil {
+		log.Error("failed to save order", slog.String("error", err.Error()), slog.Int("attempts", attempts))
+		tracing.RecordError(span, err)
+		metrics.KafkaMessagesTotal.WithLabelValues(metrics.KafkaResultFailed).Inc()
+		if ctx.Err() != nil {
+			// message is left uncommitted so it will be redelivered
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		// without dead-letter topic order would be lost, so it is retried until the storage is available again
+		if isRetryable(err) && k.dlqWriter == nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		reason := dlqReasonSave
+		if isRetryable(err) {
+			reason = dlqReasonRetriesExhausted
+		}
+		err = k.deadLetter(ctx, log, msg, reason, err, attempts)
+		result = k.deadLetterResult(err)
+		return err
+	}
+
+	result = metrics.KafkaResultSaved
+	metrics.KafkaMessagesTotal.WithLabelValues(metrics.KafkaResultSaved).Inc()
+
+	// order is saved even if commit fails, so later offsets can be committed over it
+	if err := k.kafkaReader.CommitMessages(ctx, *msg.content); err != nil {
+		log.Error("failed to commit message", slog.String("error", err.Error()))
+	} else {
+		log.Debug("order saved successfully", slog.String("order_id", order.OrderUID), slog.Int64("duration", time.Since(start).Milliseconds()))
+	}
+	return nil
+}
+
+// deadLetterResult returns the handling result of the message passed to deadLetter that returned err
+func (k *KafkaSubscriber) deadLetterResult(err error) string {
+	switch {
+	case err != nil:
+		return metrics.KafkaResultFailed
+	case k.dlqWriter == nil:
+		return metrics.KafkaResultDropped
+	default:
+		return metrics.KafkaResultDeadLettered
+	}
+}
+
+func (k *KafkaSubscriber) decodeOrder(msg message) (models.Order, error) {
+	var contentType string
+	var version int
+
+	for _, header := range msg.content.Headers {
+		switch strings.ToLower(header.Key) {
+		case contentTypeHeader:
+			contentType = string(header.Value)
+		case schemaVersionHeader:
+			v, err := strconv.Atoi(string(header.Value))
+			if err != nil || v <= 0 {
+				return models.Order{}, fmt.Errorf("%w: %q", models.ErrUnknownSchemaVersion, header.Value)
 			}
+			version = v
 		}
 	}
+
+	return k.orderDecoder.Decode(contentType, version, msg.content.Value)
+}
+
+func decodeFailureReason(err error) string {
+	if errors.Is(err, models.ErrUnknownSchemaVersion) || errors.Is(err, models.ErrUnsupportedContentType) {
+		return dlqReasonUnsupportedSchema
+	}
+	return dlqReasonUnmarshal
 }
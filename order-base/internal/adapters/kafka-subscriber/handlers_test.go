@@ -0,0 +1,200 @@
+package kafka_subscriber
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Util787/order-base/internal/config"
+	"github.com/Util787/order-base/internal/models"
+	"github.com/segmentio/kafka-go"
+)
+
+const poisonValue = "poison"
+
+// fakeReader records committed offsets, messages are passed to handlers directly
+type fakeReader struct {
+	mu        sync.Mutex
+	committed []int64
+}
+
+func (r *fakeReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	<-ctx.Done()
+	return kafka.Message{}, ctx.Err()
+}
+
+func (r *fakeReader) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, msg := range msgs {
+		r.committed = append(r.committed, msg.Offset)
+	}
+	return nil
+}
+
+func (r *fakeReader) Stats() kafka.ReaderStats { return kafka.ReaderStats{} }
+
+func (r *fakeReader) Close() error { return nil }
+
+func (r *fakeReader) committedOffsets() []int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]int64(nil), r.committed...)
+}
+
+// fakeDecoder decodes message value as order uid, poisonValue cant be decoded
+type fakeDecoder struct{}
+
+func (fakeDecoder) Decode(contentType string, version int, data []byte) (models.Order, error) {
+	if string(data) == poisonValue {
+		return models.Order{}, errors.New("invalid character 'p' looking for beginning of value")
+	}
+	return models.Order{OrderUID: string(data)}, nil
+}
+
+// fakeUsecase fails with transientFailures transient errors before saving orders
+type fakeUsecase struct {
+	mu                sync.Mutex
+	transientFailures int
+	saved             []string
+}
+
+func (u *fakeUsecase) SaveOrder(ctx context.Context, order models.Order) (models.Order, bool, error) {
+	if err := u.SaveOrders(ctx, []models.Order{order}); err != nil {
+		return models.Order{}, false, err
+	}
+	return order, true, nil
+}
+
+func (u *fakeUsecase) SaveOrders(ctx context.Context, orders []models.Order) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.transientFailures > 0 {
+		u.transientFailures--
+		return fmt.Errorf("%w: connection refused", models.ErrTransient)
+	}
+	for _, order := range orders {
+		u.saved = append(u.saved, order.OrderUID)
+	}
+	return nil
+}
+
+func (u *fakeUsecase) savedOrders() []string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return append([]string(nil), u.saved...)
+}
+
+// newTestSubscriber has no dead-letter topic and retries without noticeable backoff
+func newTestSubscriber(usecase *fakeUsecase, batchSize int) (*KafkaSubscriber, *fakeReader) {
+	reader := &fakeReader{}
+	return &KafkaSubscriber{
+		log:          slog.New(slog.NewTextHandler(io.Discard, nil)),
+		kafkaReader:  reader,
+		orderUsecase: usecase,
+		orderDecoder: fakeDecoder{},
+		retryPolicy: newRetryPolicy(config.KafkaRetryConfig{
+			MaxAttempts:    1,
+			InitialBackoff: time.Millisecond,
+			MaxBackoff:     time.Millisecond,
+		}),
+		batchSize:    batchSize,
+		batchTimeout: time.Hour, // batches are flushed when channel is closed
+	}, reader
+}
+
+// testMessages returns closed channel with messages of partition 0, their offsets are their indices
+func testMessages(values ...string) chan message {
+	ch := make(chan message, len(values))
+	for i, value := range values {
+		ch <- message{content: &kafka.Message{Topic: "orders", Partition: 0, Offset: int64(i), Value: []byte(value)}, UID: value}
+	}
+	close(ch)
+	return ch
+}
+
+// runHandler fails the test if handler doesnt drain the channel in time, e.g. because it is stuck retrying a message
+func runHandler(t *testing.T, handler func(ctx context.Context, ch <-chan message), ch chan message) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	handler(ctx, ch)
+	if ctx.Err() != nil {
+		t.Fatal("handler didnt drain messages in time")
+	}
+}
+
+func TestSaveOrderHandler_PoisonMessageWithoutDLQ(t *testing.T) {
+	usecase := &fakeUsecase{}
+	k, reader := newTestSubscriber(usecase, 0)
+
+	runHandler(t, k.saveOrderHandler, testMessages("order-1", poisonValue, "order-2"))
+
+	// poison message is dropped and committed so the rest of the partition is handled
+	if got, want := reader.committedOffsets(), []int64{0, 1, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("committed offsets = %v, want %v", got, want)
+	}
+	if got, want := usecase.savedOrders(), []string{"order-1", "order-2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("saved orders = %v, want %v", got, want)
+	}
+}
+
+func TestSaveOrdersBatchHandler_PoisonMessageWithoutDLQ(t *testing.T) {
+	usecase := &fakeUsecase{}
+	k, reader := newTestSubscriber(usecase, 3)
+
+	runHandler(t, k.saveOrdersBatchHandler, testMessages("order-1", poisonValue, "order-2"))
+
+	if got, want := reader.committedOffsets(), []int64{0, 1, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("committed offsets = %v, want %v", got, want)
+	}
+	if got, want := usecase.savedOrders(), []string{"order-1", "order-2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("saved orders = %v, want %v", got, want)
+	}
+}
+
+func TestSaveOrderHandler_TransientFailureIsRetried(t *testing.T) {
+	// more failures than retry attempts, without dead-letter topic the order must not be dropped
+	usecase := &fakeUsecase{transientFailures: 3}
+	k, reader := newTestSubscriber(usecase, 0)
+
+	runHandler(t, k.saveOrderHandler, testMessages("order-1", "order-2"))
+
+	if got, want := reader.committedOffsets(), []int64{0, 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("committed offsets = %v, want %v", got, want)
+	}
+	if got, want := usecase.savedOrders(), []string{"order-1", "order-2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("saved orders = %v, want %v", got, want)
+	}
+}
+
+func TestSaveOrderHandler_StopsRetryingWhenCanceled(t *testing.T) {
+	usecase := &fakeUsecase{transientFailures: 1 << 30}
+	k, reader := newTestSubscriber(usecase, 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		k.saveOrderHandler(ctx, testMessages("order-1", "order-2"))
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler didnt stop after ctx is done")
+	}
+	if got := reader.committedOffsets(); len(got) != 0 {
+		t.Errorf("committed offsets = %v, want none", got)
+	}
+}
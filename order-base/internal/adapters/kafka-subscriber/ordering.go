@@ -0,0 +1,49 @@
+package kafka_subscriber
+
+import (
+	"log/slog"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// partitionGate stops handling of a partition after its message was left uncommitted,
+// because committing any later offset of the partition would commit the unhandled message too.
+// Failed messages are retried until they are handled (see handleMessageUntilDone), so it happens only when handlers are stopped
+// and the rest of fetched messages must not be committed.
+//
+// Partition is opened again when the uncommitted message is fetched again (e.g. after rebalance).
+// Every handler has its own gate, so it is not safe for concurrent use
+type partitionGate struct {
+	blocked map[int]int64 // partition -> offset of the message left uncommitted
+}
+
+func newPartitionGate() *partitionGate {
+	return &partitionGate{
+		blocked: make(map[int]int64),
+	}
+}
+
+// allow reports whether msg can be handled
+func (g *partitionGate) allow(msg *kafka.Message) bool {
+	offset, blocked := g.blocked[msg.Partition]
+	if !blocked {
+		return true
+	}
+
+	// partition was rewound to the uncommitted message
+	if msg.Offset <= offset {
+		delete(g.blocked, msg.Partition)
+		return true
+	}
+	return false
+}
+
+func (g *partitionGate) block(log *slog.Logger, msg *kafka.Message) {
+	if _, blocked := g.blocked[msg.Partition]; blocked {
+		return
+	}
+
+	g.blocked[msg.Partition] = msg.Offset
+	log.Error("message is left uncommitted, partition is not handled until it is redelivered",
+		slog.Int("partition", msg.Partition), slog.Int64("offset", msg.Offset))
+}
@@ -0,0 +1,114 @@
+package kafka_subscriber
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"github.com/Util787/order-base/internal/config"
+	"github.com/Util787/order-base/internal/metrics"
+	"github.com/Util787/order-base/internal/models"
+)
+
+// retry defaults, used when config values are not set
+const (
+	defaultRetryMaxAttempts    = 5
+	defaultRetryInitialBackoff = 100 * time.Millisecond
+	defaultRetryMaxBackoff     = 5 * time.Second
+	defaultRetryMultiplier     = 2.0
+)
+
+type retryPolicy struct {
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	multiplier     float64
+	jitter         float64
+}
+
+func newRetryPolicy(cfg config.KafkaRetryConfig) retryPolicy {
+	policy := retryPolicy{
+		maxAttempts:    cfg.MaxAttempts,
+		initialBackoff: cfg.InitialBackoff,
+		maxBackoff:     cfg.MaxBackoff,
+		multiplier:     cfg.Multiplier,
+		jitter:         cfg.Jitter,
+	}
+
+	if policy.maxAttempts <= 0 {
+		policy.maxAttempts = defaultRetryMaxAttempts
+	}
+	if policy.initialBackoff <= 0 {
+		policy.initialBackoff = defaultRetryInitialBackoff
+	}
+	if policy.maxBackoff <= 0 {
+		policy.maxBackoff = defaultRetryMaxBackoff
+	}
+	if policy.multiplier < 1 {
+		policy.multiplier = defaultRetryMultiplier
+	}
+	policy.jitter = min(max(policy.jitter, 0), 1)
+
+	return policy
+}
+
+// backoff returns the delay before the next attempt, attempt starts from 1
+func (p retryPolicy) backoff(attempt int) time.Duration {
+	delay := float64(p.initialBackoff) * math.Pow(p.multiplier, float64(attempt-1))
+	delay = min(delay, float64(p.maxBackoff))
+
+	// jitter spreads retries of concurrent handlers so they dont hit postgres at the same moment
+	if p.jitter > 0 {
+		delay += delay * p.jitter * (2*rand.Float64() - 1)
+	}
+
+	return time.Duration(delay)
+}
+
+// isRetryable reports whether err is worth retrying, everything that is not marked as transient is permanent
+func isRetryable(err error) bool {
+	return errors.Is(err, models.ErrTransient)
+}
+
+// saveOrderWithRetry retries SaveOrder while it fails with retryable errors.
+//
+// It returns the number of attempts made and the last error.
+func (k *KafkaSubscriber) saveOrderWithRetry(ctx context.Context, log *slog.Logger, order models.Order) (int, error) {
+	return k.withRetry(ctx, log, func(ctx context.Context) error {
+		_, _, err := k.orderUsecase.SaveOrder(ctx, order)
+		return err
+	})
+}
+
+// saveOrdersWithRetry retries SaveOrders of the whole batch the same way as saveOrderWithRetry
+func (k *KafkaSubscriber) saveOrdersWithRetry(ctx context.Context, log *slog.Logger, orders []models.Order) (int, error) {
+	return k.withRetry(ctx, log, func(ctx context.Context) error {
+		return k.orderUsecase.SaveOrders(ctx, orders)
+	})
+}
+
+func (k *KafkaSubscriber) withRetry(ctx context.Context, log *slog.Logger, save func(ctx context.Context) error) (int, error) {
+	var err error
+
+	for attempt := 1; ; attempt++ {
+		err = save(ctx)
+		if err == nil || !isRetryable(err) || attempt >= k.retryPolicy.maxAttempts {
+			return attempt, err
+		}
+
+		delay := k.retryPolicy.backoff(attempt)
+		metrics.KafkaMessagesTotal.WithLabelValues(metrics.KafkaResultRetried).Inc()
+		log.Warn("failed to save, retrying", slog.Int("attempt", attempt), slog.Duration("backoff", delay), slog.String("error", err.Error()))
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return attempt, errors.Join(err, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
@@ -2,7 +2,11 @@ package kafka_subscriber
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
+	"sync"
+	"time"
 
 	"github.com/Util787/order-base/internal/config"
 	"github.com/Util787/order-base/internal/models"
@@ -10,17 +14,89 @@ import (
 )
 
 type OrderUsecase interface {
-	SaveOrder(ctx context.Context, order models.Order) error
+	SaveOrder(ctx context.Context, order models.Order) (models.Order, bool, error)
+	SaveOrders(ctx context.Context, orders []models.Order) error
+}
+
+// OrderDecoder decodes message value into the current order schema, contentType and version are taken from message headers and are empty if headers are missing
+type OrderDecoder interface {
+	Decode(contentType string, version int, data []byte) (models.Order, error)
+}
+
+// messageReader is implemented by *kafka.Reader
+type messageReader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Stats() kafka.ReaderStats
+	Close() error
 }
 
 type KafkaSubscriber struct {
 	log          *slog.Logger
-	kafkaReader  *kafka.Reader
+	kafkaReader  messageReader
+	brokers      []string
+	topic        string
+	dlqWriter    *kafka.Writer // nil if dead-letter topic is not configured
 	orderUsecase OrderUsecase
-	messageCh    chan message
+	orderDecoder OrderDecoder
+	retryPolicy  retryPolicy
+
+	// every handler has its own channel and messages are routed to handlers by partition,
+	// so messages of a partition are handled and committed in order by a single handler
+	handlerChs   []chan message
+	handlerChBuf uint
+
+	batchSize    int // batching is disabled if less than 2
+	batchTimeout time.Duration
+
+	// fetcher is stopped first, handlers are stopped only if they didnt drain their channels in time
+	stopFetcher  context.CancelFunc
+	stopHandlers context.CancelFunc
+	fetcherWg    sync.WaitGroup
+	handlersWg   sync.WaitGroup
+
+	readerHealth readerHealth
+}
+
+// readerHealth keeps the last error of the reader, brokers can be reachable from Ping while the reader itself
+// cant fetch (e.g. group coordinator is unavailable or the reader lost its connection)
+type readerHealth struct {
+	mu        sync.Mutex
+	lastErr   error
+	lastErrAt time.Time
+}
+
+// reader errors older than readerErrorWindow are ignored, reader retries every second or so while it is failing
+// so it is not ready as long as errors keep coming
+const readerErrorWindow = 15 * time.Second
+
+func (r *readerHealth) setErr(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lastErr = err
+	r.lastErrAt = time.Now()
 }
 
-func NewKafkaSubscriber(log *slog.Logger, cfg config.KafkaConfig, orderUsecase OrderUsecase, msgChanBuf uint) *KafkaSubscriber {
+// fetched must be called after every fetched message
+func (r *readerHealth) fetched() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lastErr = nil
+}
+
+func (r *readerHealth) err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.lastErr == nil || time.Since(r.lastErrAt) > readerErrorWindow {
+		return nil
+	}
+	return r.lastErr
+}
+
+// msgChanBuf is the buffer size of every handler channel
+func NewKafkaSubscriber(log *slog.Logger, cfg config.KafkaConfig, orderUsecase OrderUsecase, orderDecoder OrderDecoder, msgChanBuf uint) *KafkaSubscriber {
+	k := &KafkaSubscriber{}
+
 	kafkaReader := kafka.NewReader(kafka.ReaderConfig{
 		Brokers:  cfg.Brokers,
 		Topic:    cfg.Topic,
@@ -28,27 +104,165 @@ func NewKafkaSubscriber(log *slog.Logger, cfg config.KafkaConfig, orderUsecase O
 		MinBytes: 10e3, // 10KB
 		MaxBytes: 10e6, // 10MB
 		MaxWait:  cfg.MaxWait,
+		// reader retries failed connections and fetches internally without returning errors from FetchMessage,
+		// so they are taken from its error logger
+		ErrorLogger: kafka.LoggerFunc(func(msg string, args ...any) {
+			err := fmt.Errorf(msg, args...)
+			log.Debug("kafka reader error", slog.String("error", err.Error()))
+			k.readerHealth.setErr(err)
+		}),
 	})
 
-	return &KafkaSubscriber{
-		log:          log,
-		kafkaReader:  kafkaReader,
-		orderUsecase: orderUsecase,
-		messageCh:    make(chan message, msgChanBuf),
+	var dlqWriter *kafka.Writer
+	if cfg.DLQTopic != "" {
+		dlqWriter = newDLQWriter(cfg.Brokers, cfg.DLQTopic)
 	}
+
+	batchTimeout := cfg.KafkaBatchConfig.Timeout
+	if batchTimeout <= 0 {
+		batchTimeout = defaultBatchTimeout
+	}
+
+	k.log = log
+	k.kafkaReader = kafkaReader
+	k.brokers = cfg.Brokers
+	k.topic = cfg.Topic
+	k.dlqWriter = dlqWriter
+	k.orderUsecase = orderUsecase
+	k.orderDecoder = orderDecoder
+	k.retryPolicy = newRetryPolicy(cfg.KafkaRetryConfig)
+	k.handlerChBuf = msgChanBuf
+	k.batchSize = cfg.KafkaBatchConfig.Size
+	k.batchTimeout = batchTimeout
+	return k
 }
 
-func (k *KafkaSubscriber) Shutdown() error {
-	k.kafkaReader.Close()
+// Shutdown stops fetching new messages and waits until already fetched ones are handled and committed.
+//
+// If ctx is done before messages are drained then handlers are canceled, unhandled messages are left uncommitted and will be redelivered.
+// Shutdown blocks until all goroutines exit.
+func (k *KafkaSubscriber) Shutdown(ctx context.Context) error {
+	var errs []error
+
+	if k.stopFetcher != nil {
+		k.stopFetcher()
+		k.fetcherWg.Wait()
+
+		// only fetcher sends to handler channels, so handlers will exit after draining them
+		for _, ch := range k.handlerChs {
+			close(ch)
+		}
+
+		handlersDone := make(chan struct{})
+		go func() {
+			k.handlersWg.Wait()
+			close(handlersDone)
+		}()
+
+		select {
+		case <-handlersDone:
+		case <-ctx.Done():
+			errs = append(errs, fmt.Errorf("messages were not drained in time: %w", ctx.Err()))
+			k.stopHandlers()
+			<-handlersDone
+		}
+	}
+
+	// offsets are committed synchronously by handlers, so closing reader doesnt lose them
+	if err := k.kafkaReader.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("failed to close reader: %w", err))
+	}
+	if k.dlqWriter != nil {
+		if err := k.dlqWriter.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close dead-letter writer: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Ping checks that the reader doesnt fail to fetch, at least one broker is reachable and the topic has partitions
+func (k *KafkaSubscriber) Ping(ctx context.Context) error {
+	if err := k.readerHealth.err(); err != nil {
+		return fmt.Errorf("reader is failing: %w", err)
+	}
+
+	var errs []error
+	for _, broker := range k.brokers {
+		err := pingBroker(ctx, broker, k.topic)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+func pingBroker(ctx context.Context, broker, topic string) error {
+	conn, err := kafka.DialContext(ctx, "tcp", broker)
+	if err != nil {
+		return fmt.Errorf("failed to dial %s: %w", broker, err)
+	}
+	defer conn.Close()
+
+	// ReadPartitions doesnt use ctx, without deadline it can block on unresponsive broker longer than the caller waits
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return fmt.Errorf("failed to set deadline on connection to %s: %w", broker, err)
+		}
+	}
+
+	partitions, err := conn.ReadPartitions(topic)
+	if err != nil {
+		return fmt.Errorf("failed to read partitions of %s from %s: %w", topic, broker, err)
+	}
+	if len(partitions) == 0 {
+		return fmt.Errorf("topic %s has no partitions on %s", topic, broker)
+	}
 	return nil
 }
 
-func (k *KafkaSubscriber) Subscribe(ctx context.Context, numFetchers int, numHandlers int) {
-	for i := 0; i < numFetchers; i++ {
-		go k.fetcher(ctx)
+// Stats should be used only for gauge metrics because reader resets its counters on every call
+func (k *KafkaSubscriber) Stats() kafka.ReaderStats {
+	return k.kafkaReader.Stats()
+}
+
+// Subscribe starts fetcher and handlers and returns immediately, it must be called only once.
+//
+// There is only one fetcher because reader returns messages of every partition in order and concurrent fetchers would reorder them.
+// Use Shutdown to stop them, canceling ctx stops them without draining fetched messages.
+func (k *KafkaSubscriber) Subscribe(ctx context.Context, numHandlers int) {
+	fetchCtx, stopFetcher := context.WithCancel(ctx)
+	handleCtx, stopHandlers := context.WithCancel(ctx)
+	k.stopFetcher = stopFetcher
+	k.stopHandlers = stopHandlers
+
+	numHandlers = max(numHandlers, 1)
+	k.handlerChs = make([]chan message, numHandlers)
+	for i := range k.handlerChs {
+		k.handlerChs[i] = make(chan message, k.handlerChBuf)
+	}
+
+	k.fetcherWg.Add(1)
+	go func() {
+		defer k.fetcherWg.Done()
+		k.fetcher(fetchCtx)
+	}()
+
+	handler := k.saveOrderHandler
+	if k.batchSize > 1 {
+		handler = k.saveOrdersBatchHandler
 	}
 
-	for i := 0; i < numHandlers; i++ {
-		go k.saveOrderHandler(ctx)
+	for _, ch := range k.handlerChs {
+		k.handlersWg.Add(1)
+		go func() {
+			defer k.handlersWg.Done()
+			handler(handleCtx, ch)
+		}()
 	}
 }
+
+// handlerCh returns the channel of the handler that owns the partition of msg
+func (k *KafkaSubscriber) handlerCh(msg *kafka.Message) chan message {
+	return k.handlerChs[msg.Partition%len(k.handlerChs)]
+}
@@ -0,0 +1,146 @@
+package outbox_relay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/Util787/order-base/internal/common"
+	"github.com/Util787/order-base/internal/config"
+	"github.com/Util787/order-base/internal/metrics"
+	"github.com/Util787/order-base/internal/models"
+	"github.com/segmentio/kafka-go"
+)
+
+// relay defaults, used when config values are not set
+const (
+	defaultPollInterval = time.Second
+	defaultBatchSize    = 100
+)
+
+const eventTypeHeader = "event-type"
+
+type OutboxStorage interface {
+	PublishOutboxEvents(ctx context.Context, limit int, publish func(ctx context.Context, events []models.OutboxEvent) error) (int, error)
+}
+
+// OutboxRelay publishes order events from the outbox table to Kafka with order_uid as key, every event is published at least once
+type OutboxRelay struct {
+	log           *slog.Logger
+	writer        *kafka.Writer
+	outboxStorage OutboxStorage
+	pollInterval  time.Duration
+	batchSize     int
+
+	stop context.CancelFunc
+	done chan struct{}
+}
+
+func NewOutboxRelay(log *slog.Logger, brokers []string, cfg config.KafkaOutboxConfig, outboxStorage OutboxStorage) *OutboxRelay {
+	relay := &OutboxRelay{
+		log: log,
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			Topic:        cfg.Topic,
+			Balancer:     &kafka.Hash{}, // events of the same order go to the same partition
+			RequiredAcks: kafka.RequireAll,
+		},
+		outboxStorage: outboxStorage,
+		pollInterval:  cfg.PollInterval,
+		batchSize:     cfg.BatchSize,
+	}
+
+	if relay.pollInterval <= 0 {
+		relay.pollInterval = defaultPollInterval
+	}
+	if relay.batchSize <= 0 {
+		relay.batchSize = defaultBatchSize
+	}
+
+	return relay
+}
+
+// Run starts polling the outbox and returns immediately, it must be called only once
+func (r *OutboxRelay) Run(ctx context.Context) {
+	ctx, r.stop = context.WithCancel(ctx)
+	r.done = make(chan struct{})
+
+	go func() {
+		defer close(r.done)
+
+		ticker := time.NewTicker(r.pollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				r.publishAll(ctx)
+			}
+		}
+	}()
+}
+
+// Shutdown stops polling and waits until the relay goroutine exits or ctx is done.
+//
+// Publishing of the current batch is aborted, its events stay in the outbox and will be published after restart
+func (r *OutboxRelay) Shutdown(ctx context.Context) error {
+	var errs []error
+
+	if r.stop != nil {
+		r.stop()
+		select {
+		case <-r.done:
+		case <-ctx.Done():
+			errs = append(errs, fmt.Errorf("outbox relay was not stopped in time: %w", ctx.Err()))
+		}
+	}
+
+	if err := r.writer.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("failed to close writer: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// publishAll publishes batches until the outbox is drained, so backlog is not limited by batchSize per poll
+func (r *OutboxRelay) publishAll(ctx context.Context) {
+	log := r.log.With(slog.String("op", common.GetOperationName()))
+
+	for {
+		published, err := r.outboxStorage.PublishOutboxEvents(ctx, r.batchSize, r.publish)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Error("failed to publish outbox events", slog.String("error", err.Error()))
+			}
+			return
+		}
+		if published > 0 {
+			log.Debug("outbox events published", slog.Int("count", published))
+		}
+		if published < r.batchSize {
+			return
+		}
+	}
+}
+
+func (r *OutboxRelay) publish(ctx context.Context, events []models.OutboxEvent) error {
+	msgs := make([]kafka.Message, 0, len(events))
+	for _, event := range events {
+		msgs = append(msgs, kafka.Message{
+			Key:     []byte(event.OrderUID),
+			Value:   event.Payload,
+			Headers: []kafka.Header{{Key: eventTypeHeader, Value: []byte(event.Type)}},
+		})
+	}
+
+	if err := r.writer.WriteMessages(ctx, msgs...); err != nil {
+		return err
+	}
+
+	for _, event := range events {
+		metrics.OutboxEventsPublishedTotal.WithLabelValues(event.Type).Inc()
+	}
+	return nil
+}
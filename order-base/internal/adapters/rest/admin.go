@@ -0,0 +1,91 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/Util787/order-base/internal/common"
+	"github.com/Util787/order-base/internal/infra/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// CacheAdmin is implemented by storage.InMemoryStorage and storage.TieredStorage, DeleteOrder and Clear must act on the whole cache
+// orders are read from, Stats and Entry describe only the in-memory cache
+type CacheAdmin interface {
+	Stats() storage.CacheStats
+	Entry(key string) (storage.CacheEntry, bool)
+	DeleteOrder(ctx context.Context, key string) error
+	Clear(ctx context.Context) (int, error)
+}
+
+// CacheWarmUp loads up to limit the most recent orders into the cache
+type CacheWarmUp func(ctx context.Context, limit uint64) error
+
+func (h *Handler) cacheStats(c *gin.Context) {
+	c.JSON(http.StatusOK, h.cacheAdmin.Stats())
+}
+
+func (h *Handler) getCacheEntry(c *gin.Context) {
+	log := common.LogOpAndId(c.Request.Context(), common.GetOperationName(), h.log)
+
+	orderUID := c.Param("order_id")
+
+	entry, found := h.cacheAdmin.Entry(orderUID)
+	if !found {
+		newErrorResponse(c, log, http.StatusNotFound, "order is not cached", errors.New("cache entry not found"))
+		return
+	}
+
+	c.JSON(http.StatusOK, piiView(h, c, entry))
+}
+
+func (h *Handler) deleteCacheEntry(c *gin.Context) {
+	log := common.LogOpAndId(c.Request.Context(), common.GetOperationName(), h.log)
+
+	orderUID := c.Param("order_id")
+
+	if err := h.cacheAdmin.DeleteOrder(c.Request.Context(), orderUID); err != nil {
+		newErrorResponse(c, log, http.StatusInternalServerError, "failed to delete cache entry", err)
+		return
+	}
+	log.Info("Cache entry deleted", slog.String("order_id", orderUID))
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) clearCache(c *gin.Context) {
+	log := common.LogOpAndId(c.Request.Context(), common.GetOperationName(), h.log)
+
+	deleted, err := h.cacheAdmin.Clear(c.Request.Context())
+	if err != nil {
+		newErrorResponse(c, log, http.StatusInternalServerError, "failed to clear cache", err)
+		return
+	}
+	log.Info("Cache cleared", slog.Int("deleted", deleted))
+
+	c.JSON(http.StatusOK, gin.H{"deleted": deleted})
+}
+
+type warmUpCacheQuery struct {
+	Limit uint64 `form:"limit" binding:"required,min=1"`
+}
+
+func (h *Handler) warmUpCache(c *gin.Context) {
+	log := common.LogOpAndId(c.Request.Context(), common.GetOperationName(), h.log)
+
+	var query warmUpCacheQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		newErrorResponse(c, log, http.StatusBadRequest, "invalid query parameters", err)
+		return
+	}
+
+	if err := h.cacheWarmUp(c.Request.Context(), query.Limit); err != nil {
+		newErrorResponse(c, log, http.StatusInternalServerError, "failed to warm up cache", err)
+		return
+	}
+	log.Info("Cache warmed up", slog.Uint64("limit", query.Limit))
+
+	c.JSON(http.StatusOK, h.cacheAdmin.Stats())
+}
@@ -0,0 +1,88 @@
+package rest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+
+	"github.com/Util787/order-base/internal/common"
+)
+
+const apiKeyHeader = "X-API-Key"
+
+// APIKey is an entry of API keys file, only sha256 of the key is stored so the file doesnt contain secrets
+type APIKey struct {
+	Name       string   `json:"name"`
+	KeySHA256  string   `json:"key_sha256"` // hex encoded
+	Scopes     []string `json:"scopes"`
+	CustomerID string   `json:"customer_id,omitempty"` // if not empty then the key can access only orders of this customer
+}
+
+// LoadAPIKeys reads json array of APIKey from file
+func LoadAPIKeys(path string) ([]APIKey, error) {
+	op := common.GetOperationName()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var keys []APIKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return keys, nil
+}
+
+// APIKeyAuthenticator authenticates requests with "X-API-Key" header
+type APIKeyAuthenticator struct {
+	keys map[[sha256.Size]byte]APIKey
+}
+
+func NewAPIKeyAuthenticator(keys []APIKey) (*APIKeyAuthenticator, error) {
+	op := common.GetOperationName()
+
+	a := &APIKeyAuthenticator{keys: make(map[[sha256.Size]byte]APIKey, len(keys))}
+	for _, key := range keys {
+		if key.Name == "" {
+			return nil, fmt.Errorf("%s: api key name is empty", op)
+		}
+
+		hash, err := hex.DecodeString(key.KeySHA256)
+		if err != nil || len(hash) != sha256.Size {
+			return nil, fmt.Errorf("%s: api key %s: key_sha256 must be hex encoded sha256", op, key.Name)
+		}
+
+		for _, scope := range key.Scopes {
+			if !slices.Contains(knownScopes, scope) {
+				return nil, fmt.Errorf("%s: api key %s: unknown scope %s", op, key.Name, scope)
+			}
+		}
+
+		a.keys[[sha256.Size]byte(hash)] = key
+	}
+	return a, nil
+}
+
+// Authenticate looks key up by its hash, so lookup time doesnt depend on how much of the key matches
+func (a *APIKeyAuthenticator) Authenticate(r *http.Request) (Principal, error) {
+	got := r.Header.Get(apiKeyHeader)
+	if got == "" {
+		return Principal{}, errNoCredentials
+	}
+
+	key, found := a.keys[sha256.Sum256([]byte(got))]
+	if !found {
+		return Principal{}, fmt.Errorf("%w: unknown api key", errInvalidCredentials)
+	}
+
+	return Principal{
+		Subject:    key.Name,
+		Scopes:     key.Scopes,
+		CustomerID: key.CustomerID,
+	}, nil
+}
@@ -0,0 +1,152 @@
+package rest
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+
+	"github.com/Util787/order-base/internal/common"
+	"github.com/Util787/order-base/internal/config"
+	"github.com/Util787/order-base/internal/redact"
+	"github.com/gin-gonic/gin"
+)
+
+// scopes of REST API callers, they are independent so e.g. admin scope doesnt allow to read orders
+const (
+	ScopeOrdersRead  = "orders:read"
+	ScopeOrdersWrite = "orders:write"
+	ScopeAdmin       = "admin"
+	ScopeOrdersPII   = "orders:pii" // allows to see unmasked personal data if masking is enabled
+)
+
+var knownScopes = []string{ScopeOrdersRead, ScopeOrdersWrite, ScopeAdmin, ScopeOrdersPII}
+
+// Principal is an authenticated caller of REST API
+type Principal struct {
+	Subject    string // API key name or JWT subject
+	Scopes     []string
+	CustomerID string // if not empty then only orders of this customer are accessible
+}
+
+func (p Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope)
+}
+
+// Authenticator checks credentials of the request, it must return errNoCredentials if request has no credentials of its kind
+// so the next authenticator can be tried
+type Authenticator interface {
+	Authenticate(r *http.Request) (Principal, error)
+}
+
+var (
+	errNoCredentials      = errors.New("no credentials")
+	errInvalidCredentials = errors.New("invalid credentials")
+	errMissingScope       = errors.New("missing scope")
+	errForeignCustomer    = errors.New("order belongs to another customer")
+)
+
+const principalKey = "principal"
+
+// NewAuthenticators returns authenticators configured in cfg, API keys are tried first.
+// Empty result means that authentication is disabled
+func NewAuthenticators(cfg config.AuthConfig) ([]Authenticator, error) {
+	op := common.GetOperationName()
+
+	var authenticators []Authenticator
+
+	if cfg.APIKeysFile != "" {
+		keys, err := LoadAPIKeys(cfg.APIKeysFile)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		apiKeyAuthenticator, err := NewAPIKeyAuthenticator(keys)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		authenticators = append(authenticators, apiKeyAuthenticator)
+	}
+
+	if cfg.JWTAlgorithm != "" {
+		jwtAuthenticator, err := NewJWTAuthenticator(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		authenticators = append(authenticators, jwtAuthenticator)
+	}
+
+	return authenticators, nil
+}
+
+// NewAuthMiddleware tries authenticators one by one, request is rejected if none of them found credentials or found credentials are invalid
+func NewAuthMiddleware(log *slog.Logger, authenticators []Authenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		err := errNoCredentials
+		for _, authenticator := range authenticators {
+			var principal Principal
+			principal, err = authenticator.Authenticate(c.Request)
+			if errors.Is(err, errNoCredentials) {
+				continue
+			}
+			if err != nil {
+				break
+			}
+
+			c.Set(principalKey, principal)
+			c.Next()
+			return
+		}
+
+		log := common.LogOpAndId(c.Request.Context(), common.GetOperationName(), log)
+		c.Header("WWW-Authenticate", "Bearer")
+		newErrorResponse(c, log, http.StatusUnauthorized, "unauthorized", err)
+	}
+}
+
+// NewScopeMiddleware must be used after NewAuthMiddleware
+func NewScopeMiddleware(log *slog.Logger, scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, _ := principalFrom(c)
+		if !principal.HasScope(scope) {
+			log := common.LogOpAndId(c.Request.Context(), common.GetOperationName(), log)
+			newErrorResponse(c, log, http.StatusForbidden, "forbidden", fmt.Errorf("%w: %s", errMissingScope, scope))
+			return
+		}
+		c.Next()
+	}
+}
+
+// requireScope returns NewScopeMiddleware if authentication is enabled and does nothing otherwise
+func (h *Handler) requireScope(scope string) gin.HandlerFunc {
+	if len(h.authenticators) == 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
+	return NewScopeMiddleware(h.log, scope)
+}
+
+func principalFrom(c *gin.Context) (Principal, bool) {
+	value, exists := c.Get(principalKey)
+	if !exists {
+		return Principal{}, false
+	}
+	principal, ok := value.(Principal)
+	return principal, ok
+}
+
+// customerRestriction returns the customer id caller is restricted to, empty if caller can access orders of all customers
+func customerRestriction(c *gin.Context) string {
+	principal, _ := principalFrom(c)
+	return principal.CustomerID
+}
+
+// piiView returns v with personal data masked if masking is enabled and caller doesnt have ScopeOrdersPII
+func piiView[T any](h *Handler, c *gin.Context, v T) T {
+	if !h.maskPII {
+		return v
+	}
+	if principal, _ := principalFrom(c); principal.HasScope(ScopeOrdersPII) {
+		return v
+	}
+	return redact.Mask(v)
+}
@@ -0,0 +1,205 @@
+package rest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Util787/order-base/internal/config"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testJWTSecret = "test-secret"
+	testIssuer    = "https://issuer.test"
+	testAudience  = "order-base"
+
+	testReadKey  = "read-key"
+	testWriteKey = "write-key"
+)
+
+// newTestAuthRouter returns router with GET /orders protected by authenticators and ScopeOrdersRead, it responds with the subject of the caller
+func newTestAuthRouter(t *testing.T, authenticators ...Authenticator) *gin.Engine {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	router := gin.New()
+	router.Use(NewAuthMiddleware(log, authenticators))
+	router.GET("/orders", NewScopeMiddleware(log, ScopeOrdersRead), func(c *gin.Context) {
+		principal, _ := principalFrom(c)
+		c.String(http.StatusOK, principal.Subject)
+	})
+	return router
+}
+
+func newTestAPIKeyAuthenticator(t *testing.T) *APIKeyAuthenticator {
+	t.Helper()
+
+	hash := func(key string) string {
+		sum := sha256.Sum256([]byte(key))
+		return hex.EncodeToString(sum[:])
+	}
+	a, err := NewAPIKeyAuthenticator([]APIKey{
+		{Name: "reader", KeySHA256: hash(testReadKey), Scopes: []string{ScopeOrdersRead}},
+		{Name: "writer", KeySHA256: hash(testWriteKey), Scopes: []string{ScopeOrdersWrite}},
+	})
+	if err != nil {
+		t.Fatalf("NewAPIKeyAuthenticator() error = %v", err)
+	}
+	return a
+}
+
+func newTestJWTAuthenticator(t *testing.T, cfg config.AuthConfig) *JWTAuthenticator {
+	t.Helper()
+
+	a, err := NewJWTAuthenticator(cfg)
+	if err != nil {
+		t.Fatalf("NewJWTAuthenticator() error = %v", err)
+	}
+	return a
+}
+
+func testClaims(scope string, expiresIn time.Duration) jwtClaims {
+	return jwtClaims{
+		Scope: scope,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "user",
+			Issuer:    testIssuer,
+			Audience:  jwt.ClaimStrings{testAudience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
+		},
+	}
+}
+
+func signToken(t *testing.T, method jwt.SigningMethod, key any, claims jwt.Claims) string {
+	t.Helper()
+
+	token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+	if err != nil {
+		t.Fatalf("SignedString() error = %v", err)
+	}
+	return token
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	hsConfig := config.AuthConfig{JWTAlgorithm: config.JWTAlgorithmHS256, JWTSecret: testJWTSecret, JWTIssuer: testIssuer, JWTAudience: testAudience}
+	router := newTestAuthRouter(t, newTestAPIKeyAuthenticator(t), newTestJWTAuthenticator(t, hsConfig))
+	secret := []byte(testJWTSecret)
+
+	noExpiration := testClaims(ScopeOrdersRead, time.Hour)
+	noExpiration.ExpiresAt = nil
+	otherIssuer := testClaims(ScopeOrdersRead, time.Hour)
+	otherIssuer.Issuer = "https://other.test"
+	otherAudience := testClaims(ScopeOrdersRead, time.Hour)
+	otherAudience.Audience = jwt.ClaimStrings{"other"}
+
+	tests := []struct {
+		name     string
+		headers  map[string]string
+		wantCode int
+		wantBody string // checked only for successful requests
+	}{
+		{"no credentials", nil, http.StatusUnauthorized, ""},
+		{"authorization without bearer", map[string]string{"Authorization": "Basic dXNlcjpwYXNz"}, http.StatusUnauthorized, ""},
+
+		{"api key", map[string]string{apiKeyHeader: testReadKey}, http.StatusOK, "reader"},
+		{"wrong api key", map[string]string{apiKeyHeader: "wrong-key"}, http.StatusUnauthorized, ""},
+		{"api key without scope", map[string]string{apiKeyHeader: testWriteKey}, http.StatusForbidden, ""},
+		// invalid api key is not ignored in favor of other credentials
+		{"wrong api key with valid token", map[string]string{
+			apiKeyHeader:    "wrong-key",
+			"Authorization": "Bearer " + signToken(t, jwt.SigningMethodHS256, secret, testClaims(ScopeOrdersRead, time.Hour)),
+		}, http.StatusUnauthorized, ""},
+
+		{"token", map[string]string{"Authorization": "Bearer " + signToken(t, jwt.SigningMethodHS256, secret, testClaims(ScopeOrdersRead, time.Hour))}, http.StatusOK, "user"},
+		{"token with several scopes", map[string]string{"Authorization": "Bearer " + signToken(t, jwt.SigningMethodHS256, secret, testClaims(ScopeOrdersWrite+" "+ScopeOrdersRead, time.Hour))}, http.StatusOK, "user"},
+		{"token without scope", map[string]string{"Authorization": "Bearer " + signToken(t, jwt.SigningMethodHS256, secret, testClaims(ScopeOrdersWrite, time.Hour))}, http.StatusForbidden, ""},
+		{"expired token", map[string]string{"Authorization": "Bearer " + signToken(t, jwt.SigningMethodHS256, secret, testClaims(ScopeOrdersRead, -time.Hour))}, http.StatusUnauthorized, ""},
+		{"token expired within leeway", map[string]string{"Authorization": "Bearer " + signToken(t, jwt.SigningMethodHS256, secret, testClaims(ScopeOrdersRead, -jwtLeeway/2))}, http.StatusOK, "user"},
+		{"token without expiration", map[string]string{"Authorization": "Bearer " + signToken(t, jwt.SigningMethodHS256, secret, noExpiration)}, http.StatusUnauthorized, ""},
+		{"token of other issuer", map[string]string{"Authorization": "Bearer " + signToken(t, jwt.SigningMethodHS256, secret, otherIssuer)}, http.StatusUnauthorized, ""},
+		{"token for other audience", map[string]string{"Authorization": "Bearer " + signToken(t, jwt.SigningMethodHS256, secret, otherAudience)}, http.StatusUnauthorized, ""},
+		{"token with wrong secret", map[string]string{"Authorization": "Bearer " + signToken(t, jwt.SigningMethodHS256, []byte("wrong"), testClaims(ScopeOrdersRead, time.Hour))}, http.StatusUnauthorized, ""},
+		{"token with other alg", map[string]string{"Authorization": "Bearer " + signToken(t, jwt.SigningMethodHS512, secret, testClaims(ScopeOrdersRead, time.Hour))}, http.StatusUnauthorized, ""},
+		{"unsigned token", map[string]string{"Authorization": "Bearer " + signToken(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, testClaims(ScopeOrdersRead, time.Hour))}, http.StatusUnauthorized, ""},
+		{"malformed token", map[string]string{"Authorization": "Bearer not-a-jwt"}, http.StatusUnauthorized, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveTestRequest(router, tt.headers)
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d, body: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			if tt.wantCode == http.StatusOK && rec.Body.String() != tt.wantBody {
+				t.Errorf("subject = %q, want %q", rec.Body, tt.wantBody)
+			}
+			if tt.wantCode == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") != "Bearer" {
+				t.Errorf("WWW-Authenticate = %q, want Bearer", rec.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+// RS256 tokens must not be accepted when signed with HS256 using the public key as secret
+func TestAuthMiddleware_RS256AlgMismatch(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey() error = %v", err)
+	}
+	publicKeyPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	publicKeyFile := filepath.Join(t.TempDir(), "public.pem")
+	if err := os.WriteFile(publicKeyFile, publicKeyPEM, 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	router := newTestAuthRouter(t, newTestJWTAuthenticator(t, config.AuthConfig{JWTAlgorithm: config.JWTAlgorithmRS256, JWTPublicKeyFile: publicKeyFile}))
+
+	tests := []struct {
+		name     string
+		token    string
+		wantCode int
+	}{
+		{"rs256", signToken(t, jwt.SigningMethodRS256, privateKey, testClaims(ScopeOrdersRead, time.Hour)), http.StatusOK},
+		{"hs256 with public key", signToken(t, jwt.SigningMethodHS256, publicKeyPEM, testClaims(ScopeOrdersRead, time.Hour)), http.StatusUnauthorized},
+		{"rs512", signToken(t, jwt.SigningMethodRS512, privateKey, testClaims(ScopeOrdersRead, time.Hour)), http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveTestRequest(router, map[string]string{"Authorization": "Bearer " + tt.token})
+			if rec.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d, body: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+		})
+	}
+}
+
+func serveTestRequest(router http.Handler, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
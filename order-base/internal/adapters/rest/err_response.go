@@ -1,16 +1,26 @@
 package rest
 
 import (
+	"errors"
 	"log/slog"
 
+	"github.com/Util787/order-base/internal/models"
 	"github.com/gin-gonic/gin"
 )
 
 type errorResponse struct {
-	Message string `json:"message"`
+	Message string                  `json:"message"`
+	Fields  models.ValidationErrors `json:"fields,omitempty"` // invalid fields if err contains them
 }
 
 func newErrorResponse(c *gin.Context, log *slog.Logger, statusCode int, message string, err error) {
 	log.Error(message, slog.String("error", err.Error()))
-	c.AbortWithStatusJSON(statusCode, errorResponse{message})
+
+	resp := errorResponse{Message: message}
+	var validationErrs models.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		resp.Fields = validationErrs
+	}
+
+	c.AbortWithStatusJSON(statusCode, resp)
 }
@@ -3,9 +3,12 @@ package rest
 import (
 	"context"
 	"errors"
+	"io"
 	"log/slog"
 	"net/http"
+	"time"
 
+	"github.com/Util787/order-base/internal/codec"
 	"github.com/Util787/order-base/internal/common"
 	"github.com/Util787/order-base/internal/models"
 	"github.com/gin-gonic/gin"
@@ -13,11 +16,36 @@ import (
 
 type OrderUsecase interface {
 	GetOrderById(ctx context.Context, id string) (models.Order, error)
+	ListOrders(ctx context.Context, filter models.OrderFilter, cursor string, limit uint64) (models.OrdersPage, error)
+	SaveOrder(ctx context.Context, order models.Order) (models.Order, bool, error) // returns the stored order and whether it was created
+	ChangeOrderStatus(ctx context.Context, id string, status models.OrderStatus) (models.Order, error)
+	CancelOrder(ctx context.Context, id string) (models.Order, error)
 }
 
 type Handler struct {
-	log          *slog.Logger
-	orderUsecase OrderUsecase
+	log              *slog.Logger
+	orderUsecase     OrderUsecase
+	dependencyChecks []DependencyCheck
+	strictJSON       bool
+
+	cacheAdmin  CacheAdmin
+	cacheWarmUp CacheWarmUp
+
+	authenticators []Authenticator // authentication is disabled and admin routes are not registered if empty
+	maskPII        bool            // if true then personal data is masked for callers without ScopeOrdersPII
+}
+
+// bindJSON binds request body with codec.DecodeStrictJSON if strict mode is enabled and with gin binding otherwise
+func (h *Handler) bindJSON(c *gin.Context, obj any) error {
+	if !h.strictJSON {
+		return c.ShouldBindJSON(obj)
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return err
+	}
+	return codec.DecodeStrictJSON(body, obj)
 }
 
 func (h *Handler) getOrderById(c *gin.Context) {
@@ -40,5 +68,183 @@ func (h *Handler) getOrderById(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, order)
+	// orders of other customers are reported as not found so their ids cant be probed
+	if customerID := customerRestriction(c); customerID != "" && order.CustomerID != customerID {
+		newErrorResponse(c, log, http.StatusNotFound, "order not found", errForeignCustomer)
+		return
+	}
+
+	c.JSON(http.StatusOK, piiView(h, c, order))
+}
+
+type listOrdersQuery struct {
+	Limit           uint64     `form:"limit"`
+	Cursor          string     `form:"cursor"`
+	CustomerID      string     `form:"customer_id"`
+	TrackNumber     string     `form:"track_number"`
+	DeliveryService string     `form:"delivery_service"`
+	PaymentProvider string     `form:"payment_provider"`
+	Currency        string     `form:"currency"`
+	CreatedFrom     *time.Time `form:"created_from" time_format:"2006-01-02T15:04:05Z07:00"`
+	CreatedTo       *time.Time `form:"created_to" time_format:"2006-01-02T15:04:05Z07:00"`
+}
+
+func (h *Handler) listOrders(c *gin.Context) {
+	log := common.LogOpAndId(c.Request.Context(), common.GetOperationName(), h.log)
+
+	var query listOrdersQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		newErrorResponse(c, log, http.StatusBadRequest, "invalid query parameters", err)
+		return
+	}
+
+	filter := models.OrderFilter{
+		CustomerID:      query.CustomerID,
+		TrackNumber:     query.TrackNumber,
+		DeliveryService: query.DeliveryService,
+		PaymentProvider: query.PaymentProvider,
+		Currency:        query.Currency,
+		CreatedFrom:     query.CreatedFrom,
+		CreatedTo:       query.CreatedTo,
+	}
+
+	if customerID := customerRestriction(c); customerID != "" {
+		if filter.CustomerID != "" && filter.CustomerID != customerID {
+			newErrorResponse(c, log, http.StatusForbidden, "forbidden", errForeignCustomer)
+			return
+		}
+		filter.CustomerID = customerID
+	}
+
+	page, err := h.orderUsecase.ListOrders(c.Request.Context(), filter, query.Cursor, query.Limit)
+	if err != nil {
+		if errors.Is(err, models.ErrValidation) {
+			newErrorResponse(c, log, http.StatusBadRequest, "invalid input", err)
+			return
+		}
+		newErrorResponse(c, log, http.StatusInternalServerError, "failed to list orders", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, piiView(h, c, page))
+}
+
+func (h *Handler) createOrder(c *gin.Context) {
+	log := common.LogOpAndId(c.Request.Context(), common.GetOperationName(), h.log)
+
+	var order models.Order
+	if err := h.bindJSON(c, &order); err != nil {
+		newErrorResponse(c, log, http.StatusBadRequest, "invalid request body", err)
+		return
+	}
+	log.Debug("Recieved order", slog.String("order_id", order.OrderUID))
+
+	if customerID := customerRestriction(c); customerID != "" && order.CustomerID != customerID {
+		newErrorResponse(c, log, http.StatusForbidden, "forbidden", errForeignCustomer)
+		return
+	}
+
+	stored, created, err := h.orderUsecase.SaveOrder(c.Request.Context(), order)
+	if err != nil {
+		if errors.Is(err, models.ErrValidation) {
+			newErrorResponse(c, log, http.StatusBadRequest, "invalid input", err)
+			return
+		}
+		if errors.Is(err, models.ErrConflict) {
+			newErrorResponse(c, log, http.StatusConflict, "order conflicts with the existing one", err)
+			return
+		}
+		newErrorResponse(c, log, http.StatusInternalServerError, "failed to save order", err)
+		return
+	}
+
+	// order that already exists may have another status, so the stored one is returned
+	code := http.StatusOK
+	if created {
+		code = http.StatusCreated
+	}
+	c.JSON(code, piiView(h, c, stored))
+}
+
+type changeStatusRequest struct {
+	Status models.OrderStatus `json:"status" binding:"required"`
+}
+
+func (h *Handler) changeOrderStatus(c *gin.Context) {
+	log := common.LogOpAndId(c.Request.Context(), common.GetOperationName(), h.log)
+
+	orderUID := c.Param("order_id")
+
+	var req changeStatusRequest
+	if err := h.bindJSON(c, &req); err != nil {
+		newErrorResponse(c, log, http.StatusBadRequest, "invalid request body", err)
+		return
+	}
+	log.Debug("Recieved status change", slog.String("order_id", orderUID), slog.String("status", string(req.Status)))
+
+	if !h.checkCustomerAccess(c, log, orderUID) {
+		return
+	}
+
+	order, err := h.orderUsecase.ChangeOrderStatus(c.Request.Context(), orderUID, req.Status)
+	if err != nil {
+		newStatusChangeErrorResponse(c, log, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, piiView(h, c, order))
+}
+
+func (h *Handler) cancelOrder(c *gin.Context) {
+	log := common.LogOpAndId(c.Request.Context(), common.GetOperationName(), h.log)
+
+	orderUID := c.Param("order_id")
+	log.Debug("Recieved order cancellation", slog.String("order_id", orderUID))
+
+	if !h.checkCustomerAccess(c, log, orderUID) {
+		return
+	}
+
+	order, err := h.orderUsecase.CancelOrder(c.Request.Context(), orderUID)
+	if err != nil {
+		newStatusChangeErrorResponse(c, log, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, piiView(h, c, order))
+}
+
+// checkCustomerAccess responds with 404 and returns false if caller is restricted to another customer than the order has
+func (h *Handler) checkCustomerAccess(c *gin.Context, log *slog.Logger, orderUID string) bool {
+	customerID := customerRestriction(c)
+	if customerID == "" {
+		return true
+	}
+
+	order, err := h.orderUsecase.GetOrderById(c.Request.Context(), orderUID)
+	if err != nil {
+		newStatusChangeErrorResponse(c, log, err)
+		return false
+	}
+	if order.CustomerID != customerID {
+		newErrorResponse(c, log, http.StatusNotFound, "order not found", errForeignCustomer)
+		return false
+	}
+	return true
+}
+
+func newStatusChangeErrorResponse(c *gin.Context, log *slog.Logger, err error) {
+	if errors.Is(err, models.ErrOrdersNotFound) {
+		newErrorResponse(c, log, http.StatusNotFound, "order not found", err)
+		return
+	}
+	if errors.Is(err, models.ErrValidation) {
+		newErrorResponse(c, log, http.StatusBadRequest, "invalid input", err)
+		return
+	}
+	if errors.Is(err, models.ErrConflict) {
+		newErrorResponse(c, log, http.StatusConflict, "status can't be changed", err)
+		return
+	}
+	newErrorResponse(c, log, http.StatusInternalServerError, "failed to change order status", err)
 }
@@ -0,0 +1,98 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const readinessTimeout = 2 * time.Second
+
+// DependencyCheck is used in readiness probe, Check should return nil if dependency is available
+type DependencyCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+// ErrNotReady should be returned by dependency checks that are not failed but not finished yet (e.g. cache warm-up)
+var ErrNotReady = errors.New("not ready yet")
+
+// check statuses
+const (
+	statusOK          = "ok"
+	statusUnavailable = "unavailable"
+)
+
+type checkResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type dependencyResult struct {
+	name   string
+	result checkResult
+}
+
+type healthResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]checkResult `json:"checks,omitempty"`
+}
+
+// healthz only shows that process is alive and able to serve requests
+func (h *Handler) healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, healthResponse{Status: statusOK})
+}
+
+// readyz runs all dependency checks concurrently and returns 503 if any of them failed.
+// Checks that didnt finish before readinessTimeout are reported as unavailable, readyz doesnt wait for them
+func (h *Handler) readyz(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), readinessTimeout)
+	defer cancel()
+
+	results := make(chan dependencyResult, len(h.dependencyChecks)) // buffered so late checks dont block after readyz returned
+
+	for _, dep := range h.dependencyChecks {
+		go func() {
+			result := checkResult{Status: statusOK}
+			if err := dep.Check(ctx); err != nil {
+				result = checkResult{Status: statusUnavailable, Error: err.Error()}
+			}
+			results <- dependencyResult{name: dep.Name, result: result}
+		}()
+	}
+
+	resp := healthResponse{
+		Status: statusOK,
+		Checks: make(map[string]checkResult, len(h.dependencyChecks)),
+	}
+
+wait:
+	for range h.dependencyChecks {
+		select {
+		case r := <-results:
+			resp.Checks[r.name] = r.result
+		case <-ctx.Done():
+			break wait
+		}
+	}
+	for _, dep := range h.dependencyChecks {
+		if _, finished := resp.Checks[dep.Name]; !finished {
+			resp.Checks[dep.Name] = checkResult{Status: statusUnavailable, Error: "check didnt finish in time: " + ctx.Err().Error()}
+		}
+	}
+
+	for _, result := range resp.Checks {
+		if result.Status != statusOK {
+			resp.Status = statusUnavailable
+		}
+	}
+
+	if resp.Status != statusOK {
+		c.JSON(http.StatusServiceUnavailable, resp)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,88 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Util787/order-base/internal/common"
+	"github.com/Util787/order-base/internal/config"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// allowed clock skew between token issuer and this service
+const jwtLeeway = 30 * time.Second
+
+type jwtClaims struct {
+	Scope      string `json:"scope"` // space separated as in OAuth 2.0
+	CustomerID string `json:"customer_id"`
+	jwt.RegisteredClaims
+}
+
+// JWTAuthenticator authenticates requests with "Authorization: Bearer <jwt>" header, tokens are verified with locally configured key.
+//
+// Tokens must have exp claim, iss and aud are checked only if they are configured
+type JWTAuthenticator struct {
+	parser *jwt.Parser
+	key    any // []byte for HS256 and *rsa.PublicKey for RS256
+}
+
+func NewJWTAuthenticator(cfg config.AuthConfig) (*JWTAuthenticator, error) {
+	op := common.GetOperationName()
+
+	// only the configured algorithm is accepted so tokens cant choose the way they are verified
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{cfg.JWTAlgorithm}),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(jwtLeeway),
+	}
+	if cfg.JWTIssuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.JWTIssuer))
+	}
+	if cfg.JWTAudience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.JWTAudience))
+	}
+
+	a := &JWTAuthenticator{parser: jwt.NewParser(opts...)}
+
+	switch cfg.JWTAlgorithm {
+	case config.JWTAlgorithmHS256:
+		a.key = []byte(cfg.JWTSecret)
+	case config.JWTAlgorithmRS256:
+		data, err := os.ReadFile(cfg.JWTPublicKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		a.key, err = jwt.ParseRSAPublicKeyFromPEM(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	default:
+		return nil, fmt.Errorf("%s: unsupported jwt algorithm %s", op, cfg.JWTAlgorithm)
+	}
+
+	return a, nil
+}
+
+func (a *JWTAuthenticator) Authenticate(r *http.Request) (Principal, error) {
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found {
+		return Principal{}, errNoCredentials
+	}
+
+	var claims jwtClaims
+	_, err := a.parser.ParseWithClaims(token, &claims, func(*jwt.Token) (any, error) {
+		return a.key, nil
+	})
+	if err != nil {
+		return Principal{}, fmt.Errorf("%w: %w", errInvalidCredentials, err)
+	}
+
+	return Principal{
+		Subject:    claims.Subject,
+		Scopes:     strings.Fields(claims.Scope),
+		CustomerID: claims.CustomerID,
+	}, nil
+}
@@ -3,12 +3,21 @@ package rest
 import (
 	"context"
 	"log/slog"
+	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/Util787/order-base/internal/common"
+	"github.com/Util787/order-base/internal/metrics"
+	"github.com/Util787/order-base/internal/tracing"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const expectedDurationMs = 2000
@@ -21,7 +30,7 @@ func NewBasicMiddleware(log *slog.Logger) gin.HandlerFunc {
 		// gin only allows to use this way or clone request
 		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), common.ContextKey("request_id"), requestId))
 
-		log := log.With(slog.String("op", op), slog.String("request_id", requestId))
+		log := common.WithTraceID(c.Request.Context(), log).With(slog.String("op", op), slog.String("request_id", requestId))
 
 		log.Info("Request received", slog.String("ip", c.ClientIP()), slog.String("user_agent", c.GetHeader("User-Agent")), slog.String("path", c.FullPath()))
 
@@ -37,3 +46,56 @@ func NewBasicMiddleware(log *slog.Logger) gin.HandlerFunc {
 
 	}
 }
+
+// NewMetricsMiddleware should be used for the whole router so requests to unknown routes are counted too
+func NewMetricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched" // prevents high cardinality from unknown paths
+		}
+		status := strconv.Itoa(c.Writer.Status())
+
+		metrics.HTTPRequestsTotal.WithLabelValues(route, c.Request.Method, status).Inc()
+		metrics.HTTPRequestDuration.WithLabelValues(route, c.Request.Method, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+// NewTracingMiddleware continues trace from request headers if there is one, it should be used for the whole router
+func NewTracingMiddleware() gin.HandlerFunc {
+	tracer := tracing.Tracer("github.com/Util787/order-base/internal/adapters/rest")
+	propagator := otel.GetTextMapPropagator()
+
+	return func(c *gin.Context) {
+		ctx := propagator.Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		ctx, span := tracer.Start(ctx, c.Request.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(c.Request.Method),
+				semconv.HTTPRoute(route),
+				semconv.URLPath(c.Request.URL.Path),
+			),
+		)
+		defer span.End()
+
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	}
+}
@@ -3,6 +3,7 @@ package rest
 import (
 	"github.com/Util787/order-base/internal/config"
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func (h *Handler) InitRoutes(env string) *gin.Engine {
@@ -15,15 +16,41 @@ func (h *Handler) InitRoutes(env string) *gin.Engine {
 		router.Use(gin.Logger())
 	}
 
+	router.Use(NewTracingMiddleware(), NewMetricsMiddleware())
+
 	router.StaticFile("/order-base", "./ui/index.html")
+	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	router.GET("/healthz", h.healthz)
+	router.GET("/readyz", h.readyz)
 
 	v1 := router.Group("/api/v1")
 	v1.Use(NewBasicMiddleware(h.log))
+	if len(h.authenticators) > 0 {
+		v1.Use(NewAuthMiddleware(h.log, h.authenticators))
+	}
 
 	{
+		read, write := h.requireScope(ScopeOrdersRead), h.requireScope(ScopeOrdersWrite)
+
 		orders := v1.Group("/orders")
 		{
-			orders.GET("/:order_id", h.getOrderById)
+			orders.GET("", read, h.listOrders)
+			orders.POST("", write, h.createOrder)
+			orders.GET("/:order_id", read, h.getOrderById)
+			orders.PATCH("/:order_id/status", write, h.changeOrderStatus)
+			orders.POST("/:order_id/cancel", write, h.cancelOrder)
+		}
+
+		// admin routes would be open to everyone without authentication, redis cache backend has no admin
+		if len(h.authenticators) > 0 && h.cacheAdmin != nil {
+			cache := v1.Group("/admin/cache", h.requireScope(ScopeAdmin))
+			{
+				cache.GET("/stats", h.cacheStats)
+				cache.GET("/orders/:order_id", h.getCacheEntry)
+				cache.DELETE("/orders/:order_id", h.deleteCacheEntry)
+				cache.DELETE("/orders", h.clearCache)
+				cache.POST("/warm-up", h.warmUpCache)
+			}
 		}
 	}
 	return router
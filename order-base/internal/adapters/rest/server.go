@@ -13,10 +13,21 @@ type Server struct {
 	httpServer *http.Server
 }
 
-func NewHTTPServer(log *slog.Logger, env string, config config.HTTPServerConfig, orderUsecase OrderUsecase) Server {
+// dependencyChecks are used in readiness probe, cacheAdmin and cacheWarmUp are used in admin routes.
+//
+// If authenticators are empty then API is available without authentication and admin routes are disabled,
+// admin routes are disabled also if cacheAdmin is nil
+func NewHTTPServer(log *slog.Logger, env string, config config.HTTPServerConfig, orderUsecase OrderUsecase, dependencyChecks []DependencyCheck,
+	cacheAdmin CacheAdmin, cacheWarmUp CacheWarmUp, authenticators []Authenticator) Server {
 	handler := Handler{
-		log:          log,
-		orderUsecase: orderUsecase,
+		log:              log,
+		orderUsecase:     orderUsecase,
+		dependencyChecks: dependencyChecks,
+		strictJSON:       config.StrictJSON,
+		cacheAdmin:       cacheAdmin,
+		cacheWarmUp:      cacheWarmUp,
+		authenticators:   authenticators,
+		maskPII:          config.MaskPII,
 	}
 
 	httpServer := &http.Server{
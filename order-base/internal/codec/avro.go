@@ -0,0 +1,64 @@
+package codec
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/Util787/order-base/internal/models"
+	"github.com/hamba/avro/v2"
+)
+
+const orderSubject = "order"
+
+// avro fields have the same names as json ones, so orders are decoded directly into models.Order
+var avroAPI = avro.Config{TagKey: "json"}.Freeze()
+
+// AvroDecoder decodes avro payload using the writer schema of the payload version taken from SchemaRegistry
+type AvroDecoder struct {
+	schemaRegistry SchemaRegistry
+
+	mu      sync.Mutex
+	schemas map[int]avro.Schema // parsed schemas by version
+}
+
+func NewAvroDecoder(schemaRegistry SchemaRegistry) *AvroDecoder {
+	return &AvroDecoder{
+		schemaRegistry: schemaRegistry,
+		schemas:        make(map[int]avro.Schema),
+	}
+}
+
+func (d *AvroDecoder) Decode(data []byte, version int) (models.Order, error) {
+	schema, err := d.schema(version)
+	if err != nil {
+		return models.Order{}, err
+	}
+
+	var order models.Order
+	if err := avroAPI.Unmarshal(schema, data, &order); err != nil {
+		return models.Order{}, err
+	}
+	return order, nil
+}
+
+func (d *AvroDecoder) schema(version int) (avro.Schema, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if schema, ok := d.schemas[version]; ok {
+		return schema, nil
+	}
+
+	rawSchema, err := d.schemaRegistry.Schema(orderSubject, version)
+	if err != nil {
+		return nil, err
+	}
+
+	schema, err := avro.Parse(rawSchema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s schema version %d: %w", orderSubject, version, err)
+	}
+
+	d.schemas[version] = schema
+	return schema, nil
+}
@@ -0,0 +1,102 @@
+package codec
+
+import (
+	"fmt"
+	"mime"
+
+	"github.com/Util787/order-base/internal/models"
+)
+
+// supported content types of order payloads
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/x-protobuf"
+	ContentTypeAvro     = "application/avro"
+)
+
+// CurrentSchemaVersion is the version of order payload that matches models.Order, older versions are upgraded to it
+const CurrentSchemaVersion = 2
+
+// Decoder decodes payload of the given schema version, version is already checked to be from 1 to CurrentSchemaVersion
+type Decoder interface {
+	Decode(data []byte, version int) (models.Order, error)
+}
+
+// upgrades[v] upgrades order decoded from payload of version v to version v+1
+var upgrades = map[int]func(models.Order) models.Order{
+	1: upgradeV1,
+}
+
+// producers of version 1 couldnt set status, so every order starts its lifecycle as created
+func upgradeV1(order models.Order) models.Order {
+	order.Status = models.OrderStatusCreated
+	return order
+}
+
+// OrderDecoder chooses decoder by content type and upgrades decoded orders to CurrentSchemaVersion
+type OrderDecoder struct {
+	decoders           map[string]Decoder
+	defaultContentType string
+}
+
+// NewOrderDecoder returns decoder with JSON, Protobuf and Avro decoders registered,
+// defaultContentType is used for payloads without content type and must be one of them.
+//
+// If strictJSON is true then json payloads are decoded with DecodeStrictJSON
+func NewOrderDecoder(defaultContentType string, strictJSON bool, schemaRegistry SchemaRegistry) (*OrderDecoder, error) {
+	if defaultContentType == "" {
+		defaultContentType = ContentTypeJSON
+	}
+
+	d := &OrderDecoder{
+		decoders: map[string]Decoder{
+			ContentTypeJSON:     JSONDecoder{Strict: strictJSON},
+			ContentTypeProtobuf: ProtobufDecoder{},
+			ContentTypeAvro:     NewAvroDecoder(schemaRegistry),
+		},
+		defaultContentType: defaultContentType,
+	}
+
+	if _, ok := d.decoders[defaultContentType]; !ok {
+		return nil, fmt.Errorf("%w: %s", models.ErrUnsupportedContentType, defaultContentType)
+	}
+	return d, nil
+}
+
+// Decode decodes data and upgrades it to CurrentSchemaVersion.
+//
+// If contentType is empty then default one is used, if version is 0 then CurrentSchemaVersion is assumed.
+// Unsupported content types and unknown versions are reported with models.ErrUnsupportedContentType and models.ErrUnknownSchemaVersion
+func (d *OrderDecoder) Decode(contentType string, version int, data []byte) (models.Order, error) {
+	if contentType == "" {
+		contentType = d.defaultContentType
+	}
+	if version == 0 {
+		version = CurrentSchemaVersion
+	}
+
+	// parameters like charset are not used
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return models.Order{}, fmt.Errorf("%w: %s", models.ErrUnsupportedContentType, contentType)
+	}
+
+	decoder, ok := d.decoders[mediaType]
+	if !ok {
+		return models.Order{}, fmt.Errorf("%w: %s", models.ErrUnsupportedContentType, contentType)
+	}
+
+	if version < 1 || version > CurrentSchemaVersion {
+		return models.Order{}, fmt.Errorf("%w: %d", models.ErrUnknownSchemaVersion, version)
+	}
+
+	order, err := decoder.Decode(data, version)
+	if err != nil {
+		return models.Order{}, err
+	}
+
+	for v := version; v < CurrentSchemaVersion; v++ {
+		order = upgrades[v](order)
+	}
+	return order, nil
+}
@@ -0,0 +1,30 @@
+package codec
+
+import (
+	"encoding/json"
+
+	"github.com/Util787/order-base/internal/models"
+)
+
+// JSONDecoder decodes models.Order json, all schema versions have the same json fields.
+//
+// If Strict is true then DecodeStrictJSON is used
+type JSONDecoder struct {
+	Strict bool
+}
+
+func (d JSONDecoder) Decode(data []byte, _ int) (models.Order, error) {
+	var order models.Order
+
+	if d.Strict {
+		if err := DecodeStrictJSON(data, &order); err != nil {
+			return models.Order{}, err
+		}
+		return order, nil
+	}
+
+	if err := json.Unmarshal(data, &order); err != nil {
+		return models.Order{}, err
+	}
+	return order, nil
+}
@@ -0,0 +1,83 @@
+package codec
+
+import (
+	"github.com/Util787/order-base/internal/codec/orderpb"
+	"github.com/Util787/order-base/internal/models"
+	"google.golang.org/protobuf/proto"
+)
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative orderpb/order.proto
+
+// ProtobufDecoder decodes orderpb.Order, new fields are added to the same message so it is compatible with all schema versions
+type ProtobufDecoder struct{}
+
+func (ProtobufDecoder) Decode(data []byte, _ int) (models.Order, error) {
+	var pb orderpb.Order
+	if err := proto.Unmarshal(data, &pb); err != nil {
+		return models.Order{}, err
+	}
+
+	order := models.Order{
+		OrderUID:          pb.GetOrderUid(),
+		TrackNumber:       pb.GetTrackNumber(),
+		Entry:             pb.GetEntry(),
+		Locale:            pb.GetLocale(),
+		InternalSignature: pb.GetInternalSignature(),
+		CustomerID:        pb.GetCustomerId(),
+		DeliveryService:   pb.GetDeliveryService(),
+		Shardkey:          pb.GetShardkey(),
+		SmID:              int(pb.GetSmId()),
+		OofShard:          pb.GetOofShard(),
+		Status:            models.OrderStatus(pb.GetStatus()),
+	}
+	if pb.GetDateCreated() != nil {
+		order.DateCreated = pb.GetDateCreated().AsTime()
+	}
+
+	if d := pb.GetDelivery(); d != nil {
+		order.Delivery = models.Delivery{
+			DeliveryUID: d.GetDeliveryUid(),
+			Name:        d.GetName(),
+			Phone:       d.GetPhone(),
+			Zip:         d.GetZip(),
+			City:        d.GetCity(),
+			Address:     d.GetAddress(),
+			Region:      d.GetRegion(),
+			Email:       d.GetEmail(),
+		}
+	}
+
+	if p := pb.GetPayment(); p != nil {
+		order.Payment = models.Payment{
+			Transaction:  p.GetTransaction(),
+			RequestID:    p.GetRequestId(),
+			Currency:     p.GetCurrency(),
+			Provider:     p.GetProvider(),
+			Amount:       int(p.GetAmount()),
+			PaymentDt:    int(p.GetPaymentDt()),
+			Bank:         p.GetBank(),
+			DeliveryCost: int(p.GetDeliveryCost()),
+			GoodsTotal:   int(p.GetGoodsTotal()),
+			CustomFee:    int(p.GetCustomFee()),
+		}
+	}
+
+	order.Items = make([]models.Item, 0, len(pb.GetItems()))
+	for _, item := range pb.GetItems() {
+		order.Items = append(order.Items, models.Item{
+			ChrtID:      item.GetChrtId(),
+			TrackNumber: item.GetTrackNumber(),
+			Price:       int(item.GetPrice()),
+			Rid:         item.GetRid(),
+			Name:        item.GetName(),
+			Sale:        int(item.GetSale()),
+			Size:        item.GetSize(),
+			TotalPrice:  int(item.GetTotalPrice()),
+			NmID:        int(item.GetNmId()),
+			Brand:       item.GetBrand(),
+			Status:      int(item.GetStatus()),
+		})
+	}
+
+	return order, nil
+}
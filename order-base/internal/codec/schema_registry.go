@@ -0,0 +1,28 @@
+package codec
+
+import (
+	"embed"
+	"fmt"
+
+	"github.com/Util787/order-base/internal/models"
+)
+
+// SchemaRegistry returns raw schemas by subject and version, it can be implemented by a client of a real schema registry
+type SchemaRegistry interface {
+	Schema(subject string, version int) (string, error)
+}
+
+//go:embed schemas/*.avsc
+var schemaFiles embed.FS
+
+// LocalSchemaRegistry is a schema registry stand-in that serves avro schemas embedded into the binary,
+// schema of subject s and version v is stored in schemas/s.vV.avsc
+type LocalSchemaRegistry struct{}
+
+func (LocalSchemaRegistry) Schema(subject string, version int) (string, error) {
+	data, err := schemaFiles.ReadFile(fmt.Sprintf("schemas/%s.v%d.avsc", subject, version))
+	if err != nil {
+		return "", fmt.Errorf("%w: %s version %d", models.ErrUnknownSchemaVersion, subject, version)
+	}
+	return string(data), nil
+}
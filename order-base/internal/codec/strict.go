@@ -0,0 +1,180 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/Util787/order-base/internal/common"
+	"github.com/Util787/order-base/internal/models"
+)
+
+var timeType = reflect.TypeFor[time.Time]()
+
+// DecodeStrictJSON decodes data into v (pointer to struct) rejecting unknown fields, missing required fields and values of wrong types.
+//
+// Struct fields are required unless they are tagged with `strict:"optional"`, null is treated as a missing value.
+// All problems are returned at once as models.ValidationErrors with json paths of fields (e.g. "items[0].price")
+func DecodeStrictJSON(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var raw any
+	if err := dec.Decode(&raw); err != nil {
+		return fmt.Errorf("%w: invalid json: %w", models.ErrValidation, err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return fmt.Errorf("%w: invalid json: unexpected data after the top-level value", models.ErrValidation)
+	}
+
+	var errs models.ValidationErrors
+	checkJSONValue(&errs, "", raw, reflect.TypeOf(v).Elem())
+	if len(errs) > 0 {
+		return errs
+	}
+
+	// types are already checked, so it can fail only on values like invalid dates
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%w: %w", models.ErrValidation, err)
+	}
+	return nil
+}
+
+// checkJSONValue checks that value decoded with json.Decoder.UseNumber matches type t
+func checkJSONValue(errs *models.ValidationErrors, path string, value any, t reflect.Type) {
+	addErr := func(message string) {
+		*errs = append(*errs, models.FieldError{Field: path, Message: message})
+	}
+
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	if t == timeType {
+		s, ok := value.(string)
+		if !ok {
+			addErr("must be an RFC 3339 date string")
+			return
+		}
+		if _, err := time.Parse(time.RFC3339Nano, s); err != nil {
+			addErr("must be an RFC 3339 date string")
+		}
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := value.(map[string]any)
+		if !ok {
+			addErr("must be an object")
+			return
+		}
+		checkJSONObject(errs, path, obj, t)
+
+	case reflect.Slice, reflect.Array:
+		arr, ok := value.([]any)
+		if !ok {
+			addErr("must be an array")
+			return
+		}
+		for i, elem := range arr {
+			checkJSONValue(errs, fmt.Sprintf("%s[%d]", path, i), elem, t.Elem())
+		}
+
+	case reflect.String:
+		if _, ok := value.(string); !ok {
+			addErr("must be a string")
+		}
+
+	case reflect.Bool:
+		if _, ok := value.(bool); !ok {
+			addErr("must be a boolean")
+		}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := value.(json.Number)
+		if !ok {
+			addErr("must be an integer")
+			return
+		}
+		i, err := n.Int64()
+		if err != nil {
+			addErr("must be an integer")
+			return
+		}
+		if reflect.Zero(t).OverflowInt(i) {
+			addErr("is out of range")
+		}
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, ok := value.(json.Number)
+		if !ok {
+			addErr("must be a non-negative integer")
+			return
+		}
+		i, err := n.Int64()
+		if err != nil || i < 0 {
+			addErr("must be a non-negative integer")
+			return
+		}
+		if reflect.Zero(t).OverflowUint(uint64(i)) {
+			addErr("is out of range")
+		}
+
+	case reflect.Float32, reflect.Float64:
+		n, ok := value.(json.Number)
+		if !ok {
+			addErr("must be a number")
+			return
+		}
+		f, err := n.Float64()
+		if err != nil || math.IsInf(f, 0) || reflect.Zero(t).OverflowFloat(f) {
+			addErr("is out of range")
+		}
+	}
+}
+
+func checkJSONObject(errs *models.ValidationErrors, path string, obj map[string]any, t reflect.Type) {
+	known := make(map[string]bool, t.NumField())
+
+	for i := range t.NumField() {
+		field := t.Field(i)
+		name, skip := common.JSONFieldName(field)
+		if skip {
+			continue
+		}
+		known[name] = true
+
+		fieldPath := name
+		if path != "" {
+			fieldPath = path + "." + name
+		}
+
+		value, present := obj[name]
+		if !present || value == nil {
+			if field.Tag.Get("strict") != "optional" {
+				*errs = append(*errs, models.FieldError{Field: fieldPath, Message: "is required"})
+			}
+			continue
+		}
+		checkJSONValue(errs, fieldPath, value, field.Type)
+	}
+
+	// sorted so errors are reported in the same order every time
+	for _, name := range slices.Sorted(maps.Keys(obj)) {
+		if known[name] {
+			continue
+		}
+		fieldPath := name
+		if path != "" {
+			fieldPath = path + "." + name
+		}
+		*errs = append(*errs, models.FieldError{Field: fieldPath, Message: "unknown field"})
+	}
+}
@@ -0,0 +1,163 @@
+package codec
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Util787/order-base/internal/models"
+)
+
+type strictTestItem struct {
+	ID    int64  `json:"id"`
+	Name  string `json:"name"`
+	Count uint8  `json:"count" strict:"optional"`
+}
+
+type strictTestAddress struct {
+	City string `json:"city"`
+	Zip  string `json:"zip,omitempty" strict:"optional"`
+}
+
+type strictTestOrder struct {
+	UID      string            `json:"uid"`
+	Paid     bool              `json:"paid"`
+	Price    float64           `json:"price"`
+	Created  time.Time         `json:"created"`
+	Address  strictTestAddress `json:"address"`
+	Items    []strictTestItem  `json:"items"`
+	Note     *string           `json:"note" strict:"optional"`
+	Internal string            `json:"-"`
+	NoTag    string
+	private  string
+}
+
+func TestDecodeStrictJSON(t *testing.T) {
+	note := "leave at the door"
+
+	tests := []struct {
+		name       string
+		data       string
+		want       strictTestOrder
+		wantFields []string // nil if data is valid
+	}{
+		{
+			name: "valid",
+			data: `{"uid":"o1","paid":true,"price":1.5,"created":"2021-11-26T06:22:19Z","address":{"city":"Moscow","zip":"101000"},` +
+				`"items":[{"id":1,"name":"a","count":2}],"note":"leave at the door","NoTag":"x"}`,
+			want: strictTestOrder{
+				UID: "o1", Paid: true, Price: 1.5, Created: time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC),
+				Address: strictTestAddress{City: "Moscow", Zip: "101000"},
+				Items:   []strictTestItem{{ID: 1, Name: "a", Count: 2}},
+				Note:    &note, NoTag: "x",
+			},
+		},
+		{
+			name: "optional fields missing or null",
+			data: `{"uid":"o1","paid":false,"price":0,"created":"2021-11-26T06:22:19Z","address":{"city":"Moscow"},` +
+				`"items":[{"id":1,"name":"a"}],"note":null,"NoTag":""}`,
+			want: strictTestOrder{
+				UID: "o1", Created: time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC),
+				Address: strictTestAddress{City: "Moscow"},
+				Items:   []strictTestItem{{ID: 1, Name: "a"}},
+			},
+		},
+		{
+			name:       "missing fields",
+			data:       `{"uid":null,"address":{},"items":[{}]}`,
+			wantFields: []string{"uid", "paid", "price", "created", "address.city", "items[0].id", "items[0].name", "NoTag"},
+		},
+		{
+			name: "unknown fields",
+			data: `{"uid":"o1","paid":true,"price":1,"created":"2021-11-26T06:22:19Z","address":{"city":"Moscow","street":"Arbat"},` +
+				`"items":[{"id":1,"name":"a","price":1}],"NoTag":"x","zzz":1,"aaa":1}`,
+			wantFields: []string{"address.street", "items[0].price", "aaa", "zzz"},
+		},
+		{
+			name: "skipped fields are unknown",
+			data: `{"uid":"o1","paid":true,"price":1,"created":"2021-11-26T06:22:19Z","address":{"city":"Moscow"},` +
+				`"items":[],"NoTag":"x","Internal":"x","-":"x","private":"x"}`,
+			wantFields: []string{"-", "Internal", "private"},
+		},
+		{
+			name: "wrong types",
+			data: `{"uid":1,"paid":"true","price":"1","created":"yesterday","address":[],` +
+				`"items":[{"id":1.5,"name":"a"},{"id":"2","name":2,"count":-1}],"note":1,"NoTag":"x"}`,
+			wantFields: []string{"uid", "paid", "price", "created", "address", "items[0].id", "items[1].id", "items[1].name", "items[1].count", "note"},
+		},
+		{
+			name: "out of range",
+			data: `{"uid":"o1","paid":true,"price":1e400,"created":"2021-11-26T06:22:19Z","address":{"city":"Moscow"},` +
+				`"items":[{"id":9223372036854775808,"name":"a"},{"id":1,"name":"a","count":256}],"NoTag":"x"}`,
+			wantFields: []string{"price", "items[0].id", "items[1].count"},
+		},
+		{
+			name:       "not an object",
+			data:       `[]`,
+			wantFields: []string{""},
+		},
+		{
+			name:       "slice of wrong type",
+			data:       `{"uid":"o1","paid":true,"price":1,"created":"2021-11-26T06:22:19Z","address":{"city":"Moscow"},"items":{},"NoTag":"x"}`,
+			wantFields: []string{"items"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got strictTestOrder
+			err := DecodeStrictJSON([]byte(tt.data), &got)
+
+			if tt.wantFields == nil {
+				if err != nil {
+					t.Fatalf("DecodeStrictJSON() error = %v", err)
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("DecodeStrictJSON() = %+v, want %+v", got, tt.want)
+				}
+				return
+			}
+
+			var validationErrs models.ValidationErrors
+			if !errors.As(err, &validationErrs) {
+				t.Fatalf("DecodeStrictJSON() error = %v, want models.ValidationErrors", err)
+			}
+			if !errors.Is(err, models.ErrValidation) {
+				t.Errorf("DecodeStrictJSON() error = %v, want %v", err, models.ErrValidation)
+			}
+			var gotFields []string
+			for _, fieldErr := range validationErrs {
+				gotFields = append(gotFields, fieldErr.Field)
+			}
+			if !reflect.DeepEqual(gotFields, tt.wantFields) {
+				t.Errorf("invalid fields = %v, want %v", gotFields, tt.wantFields)
+			}
+		})
+	}
+}
+
+func TestDecodeStrictJSON_InvalidJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"empty", ``},
+		{"syntax error", `{"uid":`},
+		{"data after value", `{"uid":"o1"} {}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got strictTestOrder
+			err := DecodeStrictJSON([]byte(tt.data), &got)
+			if !errors.Is(err, models.ErrValidation) {
+				t.Errorf("DecodeStrictJSON() error = %v, want %v", err, models.ErrValidation)
+			}
+			var validationErrs models.ValidationErrors
+			if errors.As(err, &validationErrs) {
+				t.Errorf("DecodeStrictJSON() error = %v, want json error without fields", err)
+			}
+		})
+	}
+}
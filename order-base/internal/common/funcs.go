@@ -3,7 +3,11 @@ package common
 import (
 	"context"
 	"log/slog"
+	"reflect"
 	"runtime"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
 )
 
 // GetOperationName returns PackageName.FunctionName of the func it was called in
@@ -20,7 +24,11 @@ func GetOperationName() string {
 }
 
 // Should be used in the start of every handler and usecase
+//
+// If ctx contains a span then trace_id is added too
 func LogOpAndId(ctx context.Context, op string, log *slog.Logger) *slog.Logger {
+	log = WithTraceID(ctx, log)
+
 	requestID := ctx.Value(ContextKey("request_id"))
 	if requestID != nil {
 		return log.With(slog.String("op", op), slog.Any("request_id", requestID))
@@ -33,3 +41,30 @@ func LogOpAndId(ctx context.Context, op string, log *slog.Logger) *slog.Logger {
 
 	return log.With(slog.String("op", op))
 }
+
+// WithTraceID adds trace_id and span_id to log if ctx contains a valid span
+func WithTraceID(ctx context.Context, log *slog.Logger) *slog.Logger {
+	spanCtx := trace.SpanContextFromContext(ctx)
+	if !spanCtx.IsValid() {
+		return log
+	}
+	return log.With(slog.String("trace_id", spanCtx.TraceID().String()), slog.String("span_id", spanCtx.SpanID().String()))
+}
+
+// JSONFieldName returns the name of the field in encoding/json, skip is true for unexported and `json:"-"` fields
+func JSONFieldName(field reflect.StructField) (name string, skip bool) {
+	if !field.IsExported() {
+		return "", true
+	}
+
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", true
+	}
+
+	name, _, _ = strings.Cut(tag, ",")
+	if name == "" {
+		name = field.Name
+	}
+	return name, false
+}
@@ -15,12 +15,47 @@ const (
 	EnvProd  = "prod"
 )
 
+const (
+	TracingExporterNone   = "none"
+	TracingExporterStdout = "stdout"
+	TracingExporterOTLP   = "otlp"
+)
+
+const (
+	CacheBackendMemory = "memory"
+	CacheBackendRedis  = "redis"
+	CacheBackendTiered = "tiered" // in-memory cache in front of redis
+)
+
+const (
+	CacheExpiryAbsolute = "absolute"
+	CacheExpirySliding  = "sliding" // ttl of in-memory cache entries is restarted on every read
+)
+
+const (
+	CacheWarmUpNone   = "none"
+	CacheWarmUpRecent = "recent" // the most recent orders
+	CacheWarmUpPeriod = "period" // orders created during the last period
+)
+
+// cache defaults
+const (
+	defaultCacheTTL             = 30 * time.Second
+	defaultCacheLocalTTL        = 5 * time.Second
+	defaultCacheCleanUpInterval = time.Minute
+	defaultCacheWarmUpSize      = 100
+	defaultRedisKeyPrefix       = "order:"
+)
+
 type Config struct {
 	Env              string        `yaml:"env" env:"ENV"`
 	ShutdownTimeout  time.Duration `yaml:"shutdown-timeout" env:"SHUTDOWN_TIMEOUT"`
 	PostgresConfig   `yaml:"postgres"`
 	HTTPServerConfig `yaml:"http-server"`
 	KafkaConfig      `yaml:"kafka"`
+	CacheConfig      `yaml:"cache"`
+	RedisConfig      `yaml:"redis"`
+	TracingConfig    `yaml:"tracing"`
 }
 
 type PostgresConfig struct {
@@ -41,6 +76,31 @@ type HTTPServerConfig struct {
 	ReadHeaderTimeout time.Duration `yaml:"read-header-timeout" env:"HTTP_SERVER_READ_HEADER_TIMEOUT"`
 	WriteTimeout      time.Duration `yaml:"write-timeout" env:"HTTP_SERVER_WRITE_TIMEOUT"`
 	ReadTimeout       time.Duration `yaml:"read-timeout" env:"HTTP_SERVER_READ_TIMEOUT"`
+
+	// If StrictJSON is true then request bodies with unknown, missing or mistyped fields are rejected
+	StrictJSON bool `yaml:"strict-json" env:"HTTP_SERVER_STRICT_JSON"`
+
+	AuthConfig `yaml:"auth"`
+}
+
+const (
+	JWTAlgorithmHS256 = "HS256"
+	JWTAlgorithmRS256 = "RS256"
+)
+
+// AuthConfig defines authentication of REST API, if neither API keys nor JWT are configured then authentication is disabled
+type AuthConfig struct {
+	// APIKeysFile is a path to json file with API keys, see rest.APIKey
+	APIKeysFile string `yaml:"api-keys-file" env:"HTTP_AUTH_API_KEYS_FILE"`
+
+	JWTAlgorithm     string `yaml:"jwt-algorithm" env:"HTTP_AUTH_JWT_ALGORITHM"`             // HS256 or RS256, if empty then JWT is disabled
+	JWTSecret        string `yaml:"jwt-secret" env:"HTTP_AUTH_JWT_SECRET"`                   // used with HS256
+	JWTPublicKeyFile string `yaml:"jwt-public-key-file" env:"HTTP_AUTH_JWT_PUBLIC_KEY_FILE"` // PEM encoded RSA public key, used with RS256
+	JWTIssuer        string `yaml:"jwt-issuer" env:"HTTP_AUTH_JWT_ISSUER"`                   // if empty then issuer is not checked
+	JWTAudience      string `yaml:"jwt-audience" env:"HTTP_AUTH_JWT_AUDIENCE"`               // if empty then audience is not checked
+
+	// If MaskPII is true then personal data in responses is masked for callers without orders:pii scope
+	MaskPII bool `yaml:"mask-pii" env:"HTTP_AUTH_MASK_PII"`
 }
 
 type KafkaConfig struct {
@@ -48,6 +108,90 @@ type KafkaConfig struct {
 	Topic   string        `yaml:"topic" env:"KAFKA_TOPIC"`
 	GroupID string        `yaml:"group-id" env:"KAFKA_GROUP_ID"`
 	MaxWait time.Duration `yaml:"max-wait" env:"KAFKA_MAX_WAIT"`
+
+	// If DLQTopic is empty then messages that failed to be handled are logged and dropped
+	DLQTopic string `yaml:"dlq-topic" env:"KAFKA_DLQ_TOPIC"`
+
+	// ContentType is used for messages without content-type header, one of application/json, application/x-protobuf, application/avro.
+	// If empty then application/json is used
+	ContentType string `yaml:"content-type" env:"KAFKA_CONTENT_TYPE"`
+
+	// If StrictJSON is true then json orders with unknown, missing or mistyped fields are rejected
+	StrictJSON bool `yaml:"strict-json" env:"KAFKA_STRICT_JSON"`
+
+	KafkaRetryConfig  `yaml:"retry"`
+	KafkaBatchConfig  `yaml:"batch"`
+	KafkaOutboxConfig `yaml:"outbox"`
+}
+
+// KafkaRetryConfig defines how transient errors of saving orders are retried, zero values are replaced with defaults
+type KafkaRetryConfig struct {
+	MaxAttempts    int           `yaml:"max-attempts" env:"KAFKA_RETRY_MAX_ATTEMPTS"` // includes the first attempt
+	InitialBackoff time.Duration `yaml:"initial-backoff" env:"KAFKA_RETRY_INITIAL_BACKOFF"`
+	MaxBackoff     time.Duration `yaml:"max-backoff" env:"KAFKA_RETRY_MAX_BACKOFF"`
+	Multiplier     float64       `yaml:"multiplier" env:"KAFKA_RETRY_MULTIPLIER"`
+	Jitter         float64       `yaml:"jitter" env:"KAFKA_RETRY_JITTER"` // fraction of backoff in [0, 1]
+}
+
+// KafkaBatchConfig enables micro-batching: handlers save up to Size messages at once or whatever was collected in Timeout.
+//
+// If Size is less than 2 then messages are handled one by one
+type KafkaBatchConfig struct {
+	Size    int           `yaml:"size" env:"KAFKA_BATCH_SIZE"`
+	Timeout time.Duration `yaml:"timeout" env:"KAFKA_BATCH_TIMEOUT"` // if 0 then default timeout is used
+}
+
+// KafkaOutboxConfig defines publishing of order events from the outbox table.
+//
+// If Topic is empty then outbox relay is not started and events stay in the outbox table
+type KafkaOutboxConfig struct {
+	Topic        string        `yaml:"topic" env:"KAFKA_OUTBOX_TOPIC"`
+	PollInterval time.Duration `yaml:"poll-interval" env:"KAFKA_OUTBOX_POLL_INTERVAL"` // if 0 then default interval is used
+	BatchSize    int           `yaml:"batch-size" env:"KAFKA_OUTBOX_BATCH_SIZE"`       // if 0 then default size is used
+}
+
+// CacheConfig defines the order cache backend and limits of the in-memory cache, zero limits mean no limit
+type CacheConfig struct {
+	Backend  string        `yaml:"backend" env:"CACHE_BACKEND"`     // if empty then CacheBackendMemory is used
+	LocalTTL time.Duration `yaml:"local-ttl" env:"CACHE_LOCAL_TTL"` // max ttl of in-memory cache in tiered backend, if 0 then default ttl is used
+
+	MaxEntries int   `yaml:"max-entries" env:"CACHE_MAX_ENTRIES"`
+	MaxBytes   int64 `yaml:"max-bytes" env:"CACHE_MAX_BYTES"` // approximate
+	Shards     int   `yaml:"shards" env:"CACHE_SHARDS"`       // if 0 then default number of shards is used
+
+	// StaleTTL is how long expired orders are served from the in-memory cache while they are fetched again, 0 disables stale-while-revalidate
+	StaleTTL time.Duration `yaml:"stale-ttl" env:"CACHE_STALE_TTL"`
+	// NegativeTTL is how long not found order ids are remembered, 0 disables negative caching
+	NegativeTTL time.Duration `yaml:"negative-ttl" env:"CACHE_NEGATIVE_TTL"`
+
+	TTL             time.Duration `yaml:"ttl" env:"CACHE_TTL"`                           // if 0 then default ttl is used
+	Expiry          string        `yaml:"expiry" env:"CACHE_EXPIRY"`                     // if empty then CacheExpiryAbsolute is used
+	CleanUpInterval time.Duration `yaml:"cleanup-interval" env:"CACHE_CLEANUP_INTERVAL"` // if 0 then default interval is used
+
+	CacheWarmUpConfig `yaml:"warm-up"`
+}
+
+// CacheWarmUpConfig defines which orders are loaded into the in-memory cache on start, warm-up runs in background
+type CacheWarmUpConfig struct {
+	Strategy string        `yaml:"strategy" env:"CACHE_WARM_UP_STRATEGY"` // if empty then CacheWarmUpRecent is used
+	Size     uint64        `yaml:"size" env:"CACHE_WARM_UP_SIZE"`         // max number of loaded orders, 0 means default size for recent strategy and no limit for period one
+	Period   time.Duration `yaml:"period" env:"CACHE_WARM_UP_PERIOD"`     // used only with CacheWarmUpPeriod
+	TTL      time.Duration `yaml:"ttl" env:"CACHE_WARM_UP_TTL"`           // ttl of loaded orders, if 0 then CacheConfig.TTL is used
+}
+
+// RedisConfig is used only with redis and tiered cache backends
+type RedisConfig struct {
+	Host      string `yaml:"host" env:"REDIS_HOST"`
+	Port      int    `yaml:"port" env:"REDIS_PORT"`
+	Password  string `yaml:"password" env:"REDIS_PASSWORD"`
+	DB        int    `yaml:"db" env:"REDIS_DB"`
+	KeyPrefix string `yaml:"key-prefix" env:"REDIS_KEY_PREFIX"` // if empty then "order:" is used, so clearing the cache doesnt delete other keys of the db
+}
+
+type TracingConfig struct {
+	Exporter     string  `yaml:"exporter" env:"TRACING_EXPORTER"`           // if empty then TracingExporterNone is used
+	OTLPEndpoint string  `yaml:"otlp-endpoint" env:"TRACING_OTLP_ENDPOINT"` // host:port of OTLP HTTP collector
+	SampleRatio  float64 `yaml:"sample-ratio" env:"TRACING_SAMPLE_RATIO"`   // if 0 then all traces are sampled
 }
 
 // If CONFIG_PATH env variable is set it will load from yaml, if not it will load from env
@@ -88,5 +232,84 @@ func MustLoadConfig() *Config {
 		panic("Invalid env")
 	}
 
+	if cfg.CacheConfig.Backend == "" {
+		cfg.CacheConfig.Backend = CacheBackendMemory
+	}
+
+	if cfg.CacheConfig.Backend != CacheBackendMemory && cfg.CacheConfig.Backend != CacheBackendRedis && cfg.CacheConfig.Backend != CacheBackendTiered {
+		panic("Invalid cache backend")
+	}
+
+	if cfg.RedisConfig.KeyPrefix == "" {
+		cfg.RedisConfig.KeyPrefix = defaultRedisKeyPrefix
+	}
+
+	auth := cfg.HTTPServerConfig.AuthConfig
+	switch auth.JWTAlgorithm {
+	case "":
+	case JWTAlgorithmHS256:
+		if auth.JWTSecret == "" {
+			panic("JWT secret is not set")
+		}
+	case JWTAlgorithmRS256:
+		if auth.JWTPublicKeyFile == "" {
+			panic("JWT public key file is not set")
+		}
+	default:
+		panic("Invalid JWT algorithm")
+	}
+
+	// local entries with 0 ttl would expire within a second and every read would go to redis
+	if cfg.CacheConfig.LocalTTL == 0 {
+		cfg.CacheConfig.LocalTTL = defaultCacheLocalTTL
+	}
+
+	if cfg.CacheConfig.TTL == 0 {
+		cfg.CacheConfig.TTL = defaultCacheTTL
+	}
+
+	if cfg.CacheConfig.Expiry == "" {
+		cfg.CacheConfig.Expiry = CacheExpiryAbsolute
+	}
+
+	if cfg.CacheConfig.Expiry != CacheExpiryAbsolute && cfg.CacheConfig.Expiry != CacheExpirySliding {
+		panic("Invalid cache expiry")
+	}
+
+	if cfg.CacheConfig.CleanUpInterval == 0 {
+		cfg.CacheConfig.CleanUpInterval = defaultCacheCleanUpInterval
+	}
+
+	warmUp := &cfg.CacheConfig.CacheWarmUpConfig
+	if warmUp.Strategy == "" {
+		warmUp.Strategy = CacheWarmUpRecent
+	}
+
+	switch warmUp.Strategy {
+	case CacheWarmUpNone:
+	case CacheWarmUpRecent:
+		if warmUp.Size == 0 {
+			warmUp.Size = defaultCacheWarmUpSize
+		}
+	case CacheWarmUpPeriod:
+		if warmUp.Period <= 0 {
+			panic("Cache warm-up period is not set")
+		}
+	default:
+		panic("Invalid cache warm-up strategy")
+	}
+
+	if warmUp.TTL == 0 {
+		warmUp.TTL = cfg.CacheConfig.TTL
+	}
+
+	if cfg.TracingConfig.Exporter == "" {
+		cfg.TracingConfig.Exporter = TracingExporterNone
+	}
+
+	if cfg.TracingConfig.Exporter != TracingExporterNone && cfg.TracingConfig.Exporter != TracingExporterStdout && cfg.TracingConfig.Exporter != TracingExporterOTLP {
+		panic("Invalid tracing exporter")
+	}
+
 	return &cfg
 }
@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"cmp"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/Util787/order-base/internal/models"
+)
+
+// sameOrders reports whether the stored order equals the incoming one.
+//
+// Postgres keeps timestamps with microsecond precision and doesnt guarantee items order, so both are normalized before comparison.
+// Status is not compared because it may be changed after the order was saved.
+func sameOrders(stored, incoming models.Order) bool {
+	if !stored.DateCreated.Truncate(time.Microsecond).Equal(incoming.DateCreated.Truncate(time.Microsecond)) {
+		return false
+	}
+
+	storedItems := sortedItems(stored.Items)
+	incomingItems := sortedItems(incoming.Items)
+	if !slices.Equal(storedItems, incomingItems) {
+		return false
+	}
+
+	stored.DateCreated, incoming.DateCreated = time.Time{}, time.Time{}
+	stored.Items, incoming.Items = nil, nil
+	stored.Status, incoming.Status = "", ""
+
+	return reflect.DeepEqual(stored, incoming)
+}
+
+func sortedItems(items []models.Item) []models.Item {
+	sorted := slices.Clone(items)
+	slices.SortFunc(sorted, func(a, b models.Item) int {
+		return cmp.Compare(a.ChrtID, b.ChrtID)
+	})
+	return sorted
+}
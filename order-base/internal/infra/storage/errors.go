@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Util787/order-base/internal/models"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// postgres error codes that are worth retrying
+const (
+	pgCodeSerializationFailure = "40001"
+	pgCodeDeadlockDetected     = "40P01"
+	pgCodeAdminShutdown        = "57P01"
+	pgCodeCannotConnectNow     = "57P03"
+	pgClassConnectionException = "08"
+)
+
+const pgCodeUniqueViolation = "23505"
+
+// classifyErr wraps err with models.ErrTransient if it may disappear on retry, otherwise returns err as is
+func classifyErr(err error) error {
+	if err == nil || !isTransient(err) {
+		return err
+	}
+	return markTransient(err)
+}
+
+// markTransient should be used for errors that are transient regardless of their type (e.g. pool acquire failures)
+func markTransient(err error) error {
+	return fmt.Errorf("%w: %w", models.ErrTransient, err)
+}
+
+func isTransient(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case pgCodeSerializationFailure, pgCodeDeadlockDetected, pgCodeAdminShutdown, pgCodeCannotConnectNow:
+			return true
+		}
+		return strings.HasPrefix(pgErr.Code, pgClassConnectionException)
+	}
+
+	var connErr *pgconn.ConnectError
+	if errors.As(err, &connErr) {
+		return true
+	}
+
+	return pgconn.Timeout(err) || pgconn.SafeToRetry(err)
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == pgCodeUniqueViolation
+}
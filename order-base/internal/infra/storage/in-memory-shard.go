@@ -0,0 +1,207 @@
+package storage
+
+import (
+	"container/heap"
+	"container/list"
+	"sync"
+
+	"github.com/Util787/order-base/internal/models"
+)
+
+// cacheShard is a part of InMemoryStorage with its own lock and lru list, so operations on different shards dont block each other
+type cacheShard struct {
+	orders map[string]*list.Element // values of elements are *orderCache
+	lru    *list.List               // front is the most recently used order
+	expiry expiryHeap               // orders with expiration, the earliest one first
+	mu     sync.Mutex               // not RWMutex because reads move orders in lru list
+
+	maxEntries int    // 0 means no limit
+	maxBytes   int64  // 0 means no limit
+	bytes      int64  // approximate size of all cached orders
+	staleTTL   uint32 // seconds expired orders are kept for stale reads
+	sliding    bool   // if true then get restarts ttl of the order
+}
+
+func newCacheShard(startSize int) *cacheShard {
+	return &cacheShard{
+		orders: make(map[string]*list.Element, startSize),
+		lru:    list.New(),
+	}
+}
+
+// put returns the number of evicted orders
+func (s *cacheShard) put(cache *orderCache) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if elem, exists := s.orders[cache.key]; exists {
+		s.removeElement(elem)
+	}
+
+	s.orders[cache.key] = s.lru.PushFront(cache)
+	s.bytes += cache.size
+	cache.heapIndex = -1
+	if cache.expiration != nil {
+		heap.Push(&s.expiry, cache)
+	}
+
+	return s.evict()
+}
+
+// get doesnt return expired order, it is removed if it is not kept for stale reads.
+// With sliding expiry expiration of the returned order is moved to now + its ttl
+func (s *cacheShard) get(key string, now uint32) (models.Order, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, exists := s.orders[key]
+	if !exists {
+		return models.Order{}, false
+	}
+
+	cache := elem.Value.(*orderCache)
+	if cache.expired(now) {
+		if cache.expired(now - s.staleTTL) {
+			s.removeElement(elem)
+		}
+		return models.Order{}, false
+	}
+
+	if s.sliding && cache.expiration != nil {
+		expiration := now + cache.ttl
+		cache.expiration = &expiration
+		heap.Fix(&s.expiry, cache.heapIndex)
+	}
+
+	s.lru.MoveToFront(elem)
+	return cache.order, true
+}
+
+// getStale returns order that is expired not longer than staleTTL ago
+func (s *cacheShard) getStale(key string, now uint32) (models.Order, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, exists := s.orders[key]
+	if !exists {
+		return models.Order{}, false
+	}
+
+	cache := elem.Value.(*orderCache)
+	if !cache.expired(now) || cache.expired(now-s.staleTTL) {
+		return models.Order{}, false
+	}
+	return cache.order, true
+}
+
+// peek returns a copy of cached order without moving it in lru list, expired orders are not returned
+func (s *cacheShard) peek(key string, now uint32) (orderCache, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, exists := s.orders[key]
+	if !exists {
+		return orderCache{}, false
+	}
+
+	cache := elem.Value.(*orderCache)
+	if cache.expired(now) {
+		return orderCache{}, false
+	}
+	return *cache, true
+}
+
+func (s *cacheShard) delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if elem, exists := s.orders[key]; exists {
+		s.removeElement(elem)
+	}
+}
+
+// cleanUpExpired removes at most limit expired orders starting from the earliest expired ones and returns the number of removed orders.
+// Orders are kept for stale reads, it holds only the lock of this shard so the rest of cache stays available
+func (s *cacheShard) cleanUpExpired(now uint32, limit int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed := 0
+	for removed < limit && len(s.expiry) > 0 && s.expiry[0].expired(now-s.staleTTL) {
+		s.removeElement(s.orders[s.expiry[0].key])
+		removed++
+	}
+	return removed
+}
+
+// clear returns the number of removed orders
+func (s *cacheShard) clear() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed := len(s.orders)
+	clear(s.orders)
+	s.lru.Init()
+	s.expiry = nil
+	s.bytes = 0
+	return removed
+}
+
+func (s *cacheShard) size() (int, int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.orders), s.bytes
+}
+
+// evict removes least recently used orders until limits are satisfied, must be called under lock
+func (s *cacheShard) evict() int {
+	evicted := 0
+	for (s.maxEntries > 0 && len(s.orders) > s.maxEntries) || (s.maxBytes > 0 && s.bytes > s.maxBytes) {
+		oldest := s.lru.Back()
+		if oldest == nil {
+			break
+		}
+		s.removeElement(oldest)
+		evicted++
+	}
+	return evicted
+}
+
+// removeElement must be called under lock
+func (s *cacheShard) removeElement(elem *list.Element) {
+	cache := s.lru.Remove(elem).(*orderCache)
+	delete(s.orders, cache.key)
+	s.bytes -= cache.size
+	if cache.heapIndex >= 0 {
+		heap.Remove(&s.expiry, cache.heapIndex)
+	}
+}
+
+// expiryHeap implements heap.Interface, orders must have expiration
+type expiryHeap []*orderCache
+
+func (h expiryHeap) Len() int { return len(h) }
+
+func (h expiryHeap) Less(i, j int) bool { return *h[i].expiration < *h[j].expiration }
+
+func (h expiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].heapIndex = i
+	h[j].heapIndex = j
+}
+
+func (h *expiryHeap) Push(x any) {
+	cache := x.(*orderCache)
+	cache.heapIndex = len(*h)
+	*h = append(*h, cache)
+}
+
+func (h *expiryHeap) Pop() any {
+	old := *h
+	cache := old[len(old)-1]
+	old[len(old)-1] = nil
+	cache.heapIndex = -1
+	*h = old[:len(old)-1]
+	return cache
+}
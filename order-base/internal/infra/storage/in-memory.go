@@ -3,7 +3,8 @@ package storage
 import (
 	"context"
 	"fmt"
-	"sync"
+	"hash/fnv"
+	"sync/atomic"
 	"time"
 
 	"github.com/Util787/order-base/internal/common"
@@ -11,55 +12,202 @@ import (
 )
 
 type InMemoryStorage struct {
-	orders map[string]orderCache
-	mu     sync.RWMutex
+	shards []*cacheShard
+
+	numShards  int
+	maxEntries int   // 0 means no limit
+	maxBytes   int64 // 0 means no limit
+	staleTTL   time.Duration
+	sliding    bool
+
+	hits      atomic.Uint64
+	misses    atomic.Uint64
+	evictions atomic.Uint64
+
+	warmedUp     atomic.Bool  // true after the first WarmUp call finished
+	warmUpLoaded atomic.Int64 // orders loaded by the running or the last WarmUp call
+}
+
+const defaultNumShards = 16
+
+type InMemoryOption func(*InMemoryStorage)
+
+// WithMaxEntries limits the number of cached orders, least recently used orders are evicted first.
+//
+// Limit is split between shards so their total is exactly maxEntries, a shard evicts orders when its own part is exceeded,
+// so eviction may start before maxEntries orders are cached if keys are distributed unevenly
+func WithMaxEntries(maxEntries int) InMemoryOption {
+	return func(i *InMemoryStorage) {
+		i.maxEntries = maxEntries
+	}
+}
+
+// WithMaxBytes limits the approximate size of cached orders, least recently used orders are evicted first.
+//
+// Limit is split between shards the same way as in WithMaxEntries
+func WithMaxBytes(maxBytes int64) InMemoryOption {
+	return func(i *InMemoryStorage) {
+		i.maxBytes = maxBytes
+	}
+}
+
+// WithStaleTTL keeps expired orders for staleTTL more, they are not returned by GetOrder but can be read with GetStaleOrder
+func WithStaleTTL(staleTTL time.Duration) InMemoryOption {
+	return func(i *InMemoryStorage) {
+		i.staleTTL = staleTTL
+	}
+}
+
+// WithSlidingExpiry restarts ttl of cached order on every GetOrder call, so frequently read orders stay cached
+func WithSlidingExpiry() InMemoryOption {
+	return func(i *InMemoryStorage) {
+		i.sliding = true
+	}
+}
+
+// WithShards sets the number of cache shards, each shard has its own lock.
+//
+// Number of shards is reduced to the limits set by WithMaxEntries and WithMaxBytes if they are smaller
+func WithShards(numShards int) InMemoryOption {
+	return func(i *InMemoryStorage) {
+		if numShards > 0 {
+			i.numShards = numShards
+		}
+	}
 }
 
-// NewInMemoryStorage must return pointer because of RWMutex in it.
+// NewInMemoryStorage must return pointer because of atomic counters in it.
 //
 // startSize defines the initial capacity of the order cache map.
 //
-// cleanUpInterval defines the interval for cleaning up expired cache.
-func NewInMemoryStorage(ctx context.Context, startSize int, cleanUpInterval time.Duration) *InMemoryStorage {
+// cleanUpInterval defines the interval for cleaning up expired cache, shards are cleaned up one by one. Cleaning up stops when ctx is done.
+//
+// By default cache is unbounded, use WithMaxEntries and WithMaxBytes to limit it.
+func NewInMemoryStorage(ctx context.Context, startSize int, cleanUpInterval time.Duration, opts ...InMemoryOption) *InMemoryStorage {
 	strg := &InMemoryStorage{
-		orders: make(map[string]orderCache, startSize),
-		mu:     sync.RWMutex{},
+		numShards: defaultNumShards,
+	}
+
+	for _, opt := range opts {
+		opt(strg)
+	}
+
+	// 0 means no limit for a shard, so every shard must get a non-zero part of limits
+	if strg.maxEntries > 0 {
+		strg.numShards = min(strg.numShards, strg.maxEntries)
+	}
+	if strg.maxBytes > 0 {
+		strg.numShards = int(min(int64(strg.numShards), strg.maxBytes))
+	}
+
+	strg.shards = make([]*cacheShard, strg.numShards)
+	for idx := range strg.shards {
+		shard := newCacheShard(startSize / strg.numShards)
+		shard.maxEntries = int(shardLimit(int64(strg.maxEntries), strg.numShards, idx))
+		shard.maxBytes = shardLimit(strg.maxBytes, strg.numShards, idx)
+		shard.staleTTL = uint32(strg.staleTTL.Seconds())
+		shard.sliding = strg.sliding
+		strg.shards[idx] = shard
 	}
 
 	go func() {
 		ticker := time.NewTicker(cleanUpInterval)
-		for range ticker.C {
-			strg.cleanUpExpiredOrders()
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				strg.cleanUpExpiredOrders()
+			}
 		}
 	}()
 
 	return strg
 }
 
-type OrderStorage interface {
-	GetAllOrders(ctx context.Context, limit *uint64) ([]models.Order, error)
+type OrderLister interface {
+	ListOrders(ctx context.Context, filter models.OrderFilter, cursor *models.OrderCursor, limit uint64) ([]models.Order, error)
+}
+
+// WarmUpOptions defines which orders are loaded by WarmUp
+type WarmUpOptions struct {
+	Limit       uint64         // 0 means no limit
+	CreatedFrom *time.Time     // if nil then orders of any date are loaded
+	TTL         *time.Duration // if nil then loaded orders have no expiration
+
+	// Progress is called after every loaded page with the number of orders loaded so far, may be nil
+	Progress func(loaded int)
 }
 
-// LoadOrders loads orders from the OrderStorage into InMemoryStorage using orderUID as key.
+const warmUpPageSize = 500
+
+// WarmUp loads orders from the most recent ones into InMemoryStorage using orderUID as key and returns the number of loaded orders.
 //
-// loadLimit specifies the maximum number of orders to load.
-func (i *InMemoryStorage) LoadOrders(ctx context.Context, orderStorage OrderStorage, loadLimit *uint64, ttl *time.Duration) error {
+// Orders are loaded page by page so the cache can be used while WarmUp is running in background
+func (i *InMemoryStorage) WarmUp(ctx context.Context, orderLister OrderLister, opts WarmUpOptions) (int, error) {
 	op := common.GetOperationName()
+	defer i.warmedUp.Store(true) // failed warm-up is finished too, cache will be filled by requests
+	i.warmUpLoaded.Store(0)
 
-	orders, err := orderStorage.GetAllOrders(ctx, loadLimit)
-	if err != nil {
-		return fmt.Errorf("%s: %w", op, err)
-	}
+	filter := models.OrderFilter{CreatedFrom: opts.CreatedFrom}
+	var cursor *models.OrderCursor
+	loaded := 0
+
+	for opts.Limit == 0 || uint64(loaded) < opts.Limit {
+		pageSize := uint64(warmUpPageSize)
+		if opts.Limit != 0 {
+			pageSize = min(pageSize, opts.Limit-uint64(loaded))
+		}
 
-	for _, order := range orders {
-		i.CacheOrder(ctx, order.OrderUID, order, ttl)
+		orders, err := orderLister.ListOrders(ctx, filter, cursor, pageSize)
+		if err != nil {
+			return loaded, fmt.Errorf("%s: %w", op, err)
+		}
+
+		for _, order := range orders {
+			if err := i.CacheOrder(ctx, order.OrderUID, order, opts.TTL); err != nil {
+				return loaded, fmt.Errorf("%s: %w", op, err)
+			}
+			loaded++
+			i.warmUpLoaded.Add(1)
+		}
+
+		if opts.Progress != nil {
+			opts.Progress(loaded)
+		}
+
+		if uint64(len(orders)) < pageSize {
+			break
+		}
+		last := orders[len(orders)-1]
+		cursor = &models.OrderCursor{DateCreated: last.DateCreated, OrderUID: last.OrderUID}
 	}
-	return nil
+
+	return loaded, nil
+}
+
+// WarmedUp reports whether WarmUp has finished at least once
+func (i *InMemoryStorage) WarmedUp() bool {
+	return i.warmedUp.Load()
+}
+
+// WarmUpLoaded returns the number of orders loaded by the running or the last WarmUp call
+func (i *InMemoryStorage) WarmUpLoaded() int {
+	return int(i.warmUpLoaded.Load())
 }
 
 type orderCache struct {
+	key        string
 	order      models.Order
 	expiration *uint32 // Unix timestamp, if nil then cache has no expiration time
+	ttl        uint32  // seconds, used to restart expiration with sliding expiry
+	size       int64   // approximate size in bytes
+	heapIndex  int     // index in expiry heap of the shard, -1 if order has no expiration
+}
+
+func (c *orderCache) expired(now uint32) bool {
+	return c.expiration != nil && *c.expiration < now
 }
 
 // If ttl is nil then no ttl will be set
@@ -70,20 +218,23 @@ func (i *InMemoryStorage) CacheOrder(ctx context.Context, key string, order mode
 		return fmt.Errorf("%s: %w", op, ctx.Err())
 	}
 
-	var cache orderCache
-	cache.order = order
+	cache := &orderCache{
+		key:   key,
+		order: order,
+		size:  approxOrderSize(key, order),
+	}
 
 	if ttl != nil {
 		expiration := uint32(time.Now().Add(*ttl).Unix())
 		cache.expiration = &expiration
+		cache.ttl = uint32(ttl.Seconds())
 	} else {
 		cache.expiration = nil
 	}
 
-	i.mu.Lock()
-	defer i.mu.Unlock()
-
-	i.orders[key] = cache
+	if evicted := i.shard(key).put(cache); evicted > 0 {
+		i.evictions.Add(uint64(evicted))
+	}
 	return nil
 }
 
@@ -94,25 +245,150 @@ func (i *InMemoryStorage) GetOrder(ctx context.Context, key string) (models.Orde
 		return models.Order{}, fmt.Errorf("%s: %w", op, ctx.Err())
 	}
 
-	i.mu.RLock()
-	defer i.mu.RUnlock()
+	order, found := i.shard(key).get(key, uint32(time.Now().Unix()))
+	if !found {
+		i.misses.Add(1)
+		return models.Order{}, fmt.Errorf("%s: %w", op, models.ErrOrdersNotFound)
+	}
+
+	i.hits.Add(1)
+	return order, nil
+}
+
+// GetStaleOrder returns order that is already expired but is still kept because of WithStaleTTL, it is used for stale-while-revalidate.
+//
+// Stale reads are not counted as hits or misses
+func (i *InMemoryStorage) GetStaleOrder(ctx context.Context, key string) (models.Order, error) {
+	op := common.GetOperationName()
 
-	orderCache, exists := i.orders[key]
-	if !exists {
+	if ctx.Err() != nil {
+		return models.Order{}, fmt.Errorf("%s: %w", op, ctx.Err())
+	}
+
+	order, found := i.shard(key).getStale(key, uint32(time.Now().Unix()))
+	if !found {
 		return models.Order{}, fmt.Errorf("%s: %w", op, models.ErrOrdersNotFound)
 	}
-	return orderCache.order, nil
+	return order, nil
+}
+
+func (i *InMemoryStorage) DeleteOrder(ctx context.Context, key string) error {
+	op := common.GetOperationName()
+
+	if ctx.Err() != nil {
+		return fmt.Errorf("%s: %w", op, ctx.Err())
+	}
+
+	i.shard(key).delete(key)
+	return nil
+}
+
+// CacheEntry is a cached order with its cache metadata
+type CacheEntry struct {
+	Order     models.Order `json:"order"`
+	ExpiresAt *time.Time   `json:"expires_at"` // nil if order has no expiration
+	Size      int64        `json:"size_bytes"` // approximate
+}
+
+// Entry returns cached order without counting it as hit or miss and without moving it in lru list, so it can be used for inspection
+func (i *InMemoryStorage) Entry(key string) (CacheEntry, bool) {
+	cache, found := i.shard(key).peek(key, uint32(time.Now().Unix()))
+	if !found {
+		return CacheEntry{}, false
+	}
+
+	entry := CacheEntry{
+		Order: cache.order,
+		Size:  cache.size,
+	}
+	if cache.expiration != nil {
+		expiresAt := time.Unix(int64(*cache.expiration), 0).UTC()
+		entry.ExpiresAt = &expiresAt
+	}
+	return entry, true
+}
+
+// Clear removes all cached orders shard by shard and returns the number of removed orders, counters are not reset
+func (i *InMemoryStorage) Clear(ctx context.Context) (int, error) {
+	removed := 0
+	for _, shard := range i.shards {
+		removed += shard.clear()
+	}
+	return removed, nil
+}
+
+type CacheStats struct {
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"` // only orders evicted because of limits, expired ones are not counted
+	Entries   int    `json:"entries"`
+	Bytes     int64  `json:"bytes"` // approximate
+	Shards    int    `json:"shards"`
+}
+
+// Stats locks shards one by one so the result is not an atomic snapshot
+func (i *InMemoryStorage) Stats() CacheStats {
+	stats := CacheStats{
+		Hits:      i.hits.Load(),
+		Misses:    i.misses.Load(),
+		Evictions: i.evictions.Load(),
+		Shards:    len(i.shards),
+	}
+
+	for _, shard := range i.shards {
+		entries, bytes := shard.size()
+		stats.Entries += entries
+		stats.Bytes += bytes
+	}
+
+	return stats
 }
 
+func (i *InMemoryStorage) shard(key string) *cacheShard {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return i.shards[h.Sum32()%uint32(len(i.shards))]
+}
+
+// shard removes at most this number of expired orders per clean up, the rest are removed by the next ones
+// or earlier on reads or eviction, so the shard lock is held for a bounded time
+const cleanUpLimit = 1024
+
+// cleanUpExpiredOrders cleans shards one by one so only one shard is locked at a time
 func (i *InMemoryStorage) cleanUpExpiredOrders() {
-	currentTime := uint32(time.Now().Unix())
+	for _, shard := range i.shards {
+		shard.cleanUpExpired(uint32(time.Now().Unix()), cleanUpLimit)
+	}
+}
 
-	i.mu.Lock()
-	defer i.mu.Unlock()
+// shardLimit returns the part of limit for the shard idx of numShards, remainder is spread over the first shards so parts sum up to limit
+func shardLimit(limit int64, numShards, idx int) int64 {
+	part := limit / int64(numShards)
+	if int64(idx) < limit%int64(numShards) {
+		part++
+	}
+	return part
+}
 
-	for key, cache := range i.orders {
-		if cache.expiration != nil && *cache.expiration < currentTime {
-			delete(i.orders, key)
-		}
+// approxOrderSize estimates memory used by the cached order, only strings are counted precisely
+func approxOrderSize(key string, order models.Order) int64 {
+	const orderCacheOverhead = 512 // structs, pointers and list element
+	const itemOverhead = 128
+
+	size := int64(orderCacheOverhead + len(key))
+	size += int64(len(order.OrderUID) + len(order.TrackNumber) + len(order.Entry) + len(order.Locale) +
+		len(order.InternalSignature) + len(order.CustomerID) + len(order.DeliveryService) + len(order.Shardkey) +
+		len(order.OofShard) + len(order.Status))
+
+	d := order.Delivery
+	size += int64(len(d.DeliveryUID) + len(d.Name) + len(d.Phone) + len(d.Zip) + len(d.City) + len(d.Address) + len(d.Region) + len(d.Email))
+
+	p := order.Payment
+	size += int64(len(p.Transaction) + len(p.RequestID) + len(p.Currency) + len(p.Provider) + len(p.Bank))
+
+	for _, item := range order.Items {
+		size += int64(itemOverhead + len(item.TrackNumber) + len(item.Rid) + len(item.Name) + len(item.Size) + len(item.Brand))
 	}
+
+	return size
 }
@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"testing"
+	"time"
+
+	"github.com/Util787/order-base/internal/models"
+)
+
+const benchOrders = 10000
+
+// testOrder returns a valid order with unique uids, it is used by tests and benchmarks of storages
+func testOrder(i int) models.Order {
+	uid := fmt.Sprintf("b563feb7b2b84b6test%013d", i)
+	return models.Order{
+		OrderUID:    uid,
+		TrackNumber: "WBILMTESTTRACK",
+		Entry:       "WBIL",
+		Delivery: models.Delivery{
+			DeliveryUID: "delivery-" + uid,
+			Name:        "Test Testov",
+			Phone:       "+9720000000",
+			Zip:         "2639809",
+			City:        "Kiryat Mozkin",
+			Address:     "Ploshad Mira 15",
+			Region:      "Kraiot",
+			Email:       "test@gmail.com",
+		},
+		Payment: models.Payment{Transaction: uid, Currency: "USD", Provider: "wbpay", Amount: 1817, GoodsTotal: 317, DeliveryCost: 1500},
+		Items: []models.Item{
+			{ChrtID: 9934930, TrackNumber: "WBILMTESTTRACK", Price: 453, Rid: "ab4219087a764ae0btest", Name: "Mascaras", TotalPrice: 317, NmID: 2389212, Brand: "Vivienne Sabo", Status: 202},
+		},
+		Locale:          "en",
+		CustomerID:      "test",
+		DeliveryService: "meest",
+		DateCreated:     time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC),
+		Status:          models.OrderStatusCreated,
+	}
+}
+
+// BenchmarkInMemoryStorage compares the sharded cache with the previous single mutex design under concurrent
+// REST reads (GetOrder) and Kafka writes (CacheOrder). One shard has the same locking as the previous implementation:
+// one mutex and one lru list for the whole cache.
+//
+//	go test ./internal/infra/storage -bench InMemoryStorage -cpu 1,4,16
+func BenchmarkInMemoryStorage(b *testing.B) {
+	orders := make([]models.Order, benchOrders)
+	for i := range orders {
+		orders[i] = testOrder(i)
+	}
+	ttl := time.Minute
+
+	designs := []struct {
+		name   string
+		shards int
+	}{
+		{"single_mutex", 1},
+		{"sharded_16", defaultNumShards},
+		{"sharded_64", 64},
+	}
+	mixes := []struct {
+		name         string
+		writePercent int
+	}{
+		{"reads_only", 0},
+		{"reads_90_writes_10", 10},
+		{"reads_50_writes_50", 50},
+	}
+
+	for _, design := range designs {
+		for _, mix := range mixes {
+			b.Run(design.name+"/"+mix.name, func(b *testing.B) {
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+
+				// bounded so writes cause evictions as in production
+				strg := NewInMemoryStorage(ctx, benchOrders, time.Hour, WithShards(design.shards), WithMaxEntries(benchOrders*3/4))
+				for _, order := range orders {
+					strg.CacheOrder(ctx, order.OrderUID, order, &ttl)
+				}
+
+				b.ReportAllocs()
+				b.ResetTimer()
+				b.RunParallel(func(pb *testing.PB) {
+					rnd := rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+					for pb.Next() {
+						order := orders[rnd.IntN(len(orders))]
+						if rnd.IntN(100) < mix.writePercent {
+							strg.CacheOrder(ctx, order.OrderUID, order, &ttl)
+						} else {
+							strg.GetOrder(ctx, order.OrderUID)
+						}
+					}
+				})
+			})
+		}
+	}
+}
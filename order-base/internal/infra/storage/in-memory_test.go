@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Util787/order-base/internal/models"
+)
+
+func TestInMemoryStorage_EvictionLimits(t *testing.T) {
+	orderSize := approxOrderSize(testOrder(0).OrderUID, testOrder(0))
+
+	tests := []struct {
+		name       string
+		opts       []InMemoryOption
+		maxEntries int
+		maxBytes   int64
+		wantShards int
+	}{
+		{"entries not divisible by shards", []InMemoryOption{WithMaxEntries(100)}, 100, 0, defaultNumShards},
+		{"fewer entries than shards", []InMemoryOption{WithMaxEntries(10)}, 10, 0, 10},
+		{"bytes", []InMemoryOption{WithMaxBytes(50 * orderSize)}, 0, 50 * orderSize, defaultNumShards},
+		{"entries and bytes", []InMemoryOption{WithMaxEntries(70), WithMaxBytes(50 * orderSize)}, 70, 50 * orderSize, defaultNumShards},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			strg := NewInMemoryStorage(ctx, 0, time.Hour, tt.opts...)
+
+			if len(strg.shards) != tt.wantShards {
+				t.Errorf("shards = %d, want %d", len(strg.shards), tt.wantShards)
+			}
+			var shardEntries int
+			var shardBytes int64
+			for _, shard := range strg.shards {
+				shardEntries += shard.maxEntries
+				shardBytes += shard.maxBytes
+			}
+			if shardEntries != tt.maxEntries || shardBytes != tt.maxBytes {
+				t.Errorf("sum of shard limits = %d entries, %d bytes, want %d entries, %d bytes", shardEntries, shardBytes, tt.maxEntries, tt.maxBytes)
+			}
+
+			const cached = 1000
+			for i := range cached {
+				order := testOrder(i)
+				if err := strg.CacheOrder(ctx, order.OrderUID, order, nil); err != nil {
+					t.Fatalf("CacheOrder() error = %v", err)
+				}
+			}
+
+			stats := strg.Stats()
+			if tt.maxEntries > 0 && stats.Entries > tt.maxEntries {
+				t.Errorf("entries = %d, want at most %d", stats.Entries, tt.maxEntries)
+			}
+			if tt.maxBytes > 0 && stats.Bytes > tt.maxBytes {
+				t.Errorf("bytes = %d, want at most %d", stats.Bytes, tt.maxBytes)
+			}
+			if stats.Evictions != uint64(cached-stats.Entries) {
+				t.Errorf("evictions = %d, want %d", stats.Evictions, cached-stats.Entries)
+			}
+			// the most recently used order is evicted last
+			if _, found := strg.Entry(testOrder(cached - 1).OrderUID); !found {
+				t.Error("the last cached order is evicted")
+			}
+		})
+	}
+}
+
+func TestCacheShard_CleanUpExpired(t *testing.T) {
+	shard := newCacheShard(0)
+	now := uint32(time.Now().Unix())
+
+	// expiration of i-th order is now - 10 + i, orders are put in mixed order
+	for _, i := range []int{7, 2, 9, 0, 5, 3, 8, 1, 6, 4} {
+		expiration := now - 10 + uint32(i)
+		order := testOrder(i)
+		shard.put(&orderCache{key: order.OrderUID, order: order, expiration: &expiration})
+	}
+	noTTL := testOrder(100)
+	shard.put(&orderCache{key: noTTL.OrderUID, order: noTTL})
+
+	// orders 0..9 are expired at now + 1, only the earliest ones are removed within the limit
+	if removed := shard.cleanUpExpired(now+1, 4); removed != 4 {
+		t.Fatalf("cleanUpExpired() = %d, want 4", removed)
+	}
+	for i := range 10 {
+		_, found := shard.orders[testOrder(i).OrderUID]
+		if wantFound := i >= 4; found != wantFound {
+			t.Errorf("order %d found = %v, want %v", i, found, wantFound)
+		}
+	}
+
+	// orders 4..6 are expired at now - 3
+	if removed := shard.cleanUpExpired(now-3, 100); removed != 3 {
+		t.Errorf("cleanUpExpired() = %d, want 3", removed)
+	}
+	if removed := shard.cleanUpExpired(now+1, 100); removed != 3 {
+		t.Errorf("cleanUpExpired() = %d, want 3", removed)
+	}
+	if entries, _ := shard.size(); entries != 1 {
+		t.Errorf("entries = %d, want only the order without expiration", entries)
+	}
+	if len(shard.expiry) != 0 {
+		t.Errorf("expiry heap has %d orders, want 0", len(shard.expiry))
+	}
+}
+
+func TestCacheShard_CleanUpExpiredStaleAndSliding(t *testing.T) {
+	shard := newCacheShard(0)
+	shard.staleTTL = 5
+	shard.sliding = true
+	now := uint32(time.Now().Unix())
+
+	read, unread := testOrder(1), testOrder(2)
+	for _, order := range []models.Order{read, unread} {
+		expiration := now + 10
+		shard.put(&orderCache{key: order.OrderUID, order: order, expiration: &expiration, ttl: 10})
+	}
+
+	// reading moves expiration of the order to now + 5 + ttl
+	if _, found := shard.get(read.OrderUID, now+5); !found {
+		t.Fatal("get() didnt find order")
+	}
+
+	// unread order is kept for stale reads until now + 10 + staleTTL
+	if removed := shard.cleanUpExpired(now+15, cleanUpLimit); removed != 0 {
+		t.Errorf("cleanUpExpired() = %d, want 0 while order is kept for stale reads", removed)
+	}
+	if removed := shard.cleanUpExpired(now+16, cleanUpLimit); removed != 1 {
+		t.Errorf("cleanUpExpired() = %d, want 1", removed)
+	}
+	if _, found := shard.orders[read.OrderUID]; !found {
+		t.Error("order with restarted ttl is removed")
+	}
+}
@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/Util787/order-base/internal/common"
+	"github.com/Util787/order-base/internal/models"
+)
+
+const insertOutboxEventQuery = `INSERT INTO outbox (event_type, order_uid, payload) VALUES ($1, $2, $3)`
+
+func (b *insertBatch) queueOutboxEvent(event models.OrderEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s event: %w", event.Type, err)
+	}
+
+	b.queue("outbox event", insertOutboxEventQuery, event.Type, event.OrderUID, payload)
+	return nil
+}
+
+// PublishOutboxEvents locks up to limit the oldest outbox events, passes them to publish and deletes them if publish succeeded.
+//
+// Events are deleted in the same transaction they were locked in, so if the transaction fails after publish they are published again (at-least-once).
+// Locked events are skipped by concurrent calls, so several relays can publish events in parallel but then events of the same order may be published out of order.
+//
+// It returns the number of published events.
+func (p *PostgresStorage) PublishOutboxEvents(ctx context.Context, limit int, publish func(ctx context.Context, events []models.OutboxEvent) error) (int, error) {
+	op := common.GetOperationName()
+
+	conn, err := p.pgxPool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("%s: failed to acquire connection: %w", op, markTransient(err))
+	}
+	defer conn.Release()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("%s: failed to begin transaction: %w", op, classifyErr(err))
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `
+	SELECT id, event_type, order_uid, payload FROM outbox
+	ORDER BY id
+	LIMIT $1
+	FOR UPDATE SKIP LOCKED`, limit)
+	if err != nil {
+		return 0, fmt.Errorf("%s: failed to execute query: %w", op, classifyErr(err))
+	}
+
+	events := make([]models.OutboxEvent, 0, limit)
+	ids := make([]int64, 0, limit)
+	for rows.Next() {
+		var event models.OutboxEvent
+		if err := rows.Scan(&event.ID, &event.Type, &event.OrderUID, &event.Payload); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("%s: failed to scan rows: %w", op, classifyErr(err))
+		}
+		events = append(events, event)
+		ids = append(ids, event.ID)
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		return 0, fmt.Errorf("%s: rows err: %w", op, classifyErr(rows.Err()))
+	}
+
+	if len(events) == 0 {
+		return 0, nil
+	}
+
+	if err := publish(ctx, events); err != nil {
+		return 0, fmt.Errorf("%s: failed to publish events: %w", op, err)
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM outbox WHERE id = ANY($1)`, ids); err != nil {
+		return 0, fmt.Errorf("%s: failed to delete published events: %w", op, classifyErr(err))
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("%s: failed to commit transaction: %w", op, classifyErr(err))
+	}
+
+	return len(events), nil
+}
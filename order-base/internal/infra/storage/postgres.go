@@ -6,11 +6,14 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"time"
 
 	sq "github.com/Masterminds/squirrel"
 	"github.com/Util787/order-base/internal/common"
 	"github.com/Util787/order-base/internal/config"
 	"github.com/Util787/order-base/internal/models"
+	"github.com/Util787/order-base/internal/tracing"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -37,6 +40,9 @@ func MustInitPostgres(ctx context.Context, cfg config.PostgresConfig) PostgresSt
 	pgxConfig.MaxConnLifetime = cfg.ConnMaxLifetime
 	pgxConfig.MaxConnIdleTime = cfg.ConnMaxIdleTime
 
+	// every query is traced
+	pgxConfig.ConnConfig.Tracer = tracing.NewPgxTracer()
+
 	pool, err := pgxpool.NewWithConfig(ctx, pgxConfig)
 	if err != nil {
 		panic(fmt.Errorf("failed to create postgres connection pool: %w", err))
@@ -56,6 +62,15 @@ func (p *PostgresStorage) Shutdown() {
 	p.pgxPool.Close()
 }
 
+func (p *PostgresStorage) Ping(ctx context.Context) error {
+	return p.pgxPool.Ping(ctx)
+}
+
+// Stat returns connection pool statistics, it should be used for metrics
+func (p *PostgresStorage) Stat() *pgxpool.Stat {
+	return p.pgxPool.Stat()
+}
+
 var orderQueryBase sq.SelectBuilder = sq.StatementBuilder.
 	PlaceholderFormat(sq.Dollar).
 	Select(
@@ -70,6 +85,7 @@ var orderQueryBase sq.SelectBuilder = sq.StatementBuilder.
 		"orders.sm_id",
 		"orders.date_created",
 		"orders.oof_shard",
+		"orders.status",
 
 		"deliveries.delivery_uid",
 		"deliveries.name",
@@ -105,6 +121,58 @@ var orderQueryBase sq.SelectBuilder = sq.StatementBuilder.
 		"payments.transaction",
 	)
 
+// scanOrder scans a row selected with orderQueryBase
+func scanOrder(row pgx.Row) (models.Order, error) {
+	var ord models.Order
+	var itemsJSON []byte
+
+	err := row.Scan(
+		&ord.OrderUID,
+		&ord.TrackNumber,
+		&ord.Entry,
+		&ord.Locale,
+		&ord.InternalSignature,
+		&ord.CustomerID,
+		&ord.DeliveryService,
+		&ord.Shardkey,
+		&ord.SmID,
+		&ord.DateCreated,
+		&ord.OofShard,
+		&ord.Status,
+
+		&ord.Delivery.DeliveryUID,
+		&ord.Delivery.Name,
+		&ord.Delivery.Phone,
+		&ord.Delivery.Zip,
+		&ord.Delivery.City,
+		&ord.Delivery.Address,
+		&ord.Delivery.Region,
+		&ord.Delivery.Email,
+
+		&ord.Payment.Transaction,
+		&ord.Payment.RequestID,
+		&ord.Payment.Currency,
+		&ord.Payment.Provider,
+		&ord.Payment.Amount,
+		&ord.Payment.PaymentDt,
+		&ord.Payment.Bank,
+		&ord.Payment.DeliveryCost,
+		&ord.Payment.GoodsTotal,
+		&ord.Payment.CustomFee,
+
+		&itemsJSON,
+	)
+	if err != nil {
+		return models.Order{}, err
+	}
+
+	if err := json.Unmarshal(itemsJSON, &ord.Items); err != nil {
+		return models.Order{}, fmt.Errorf("failed to unmarshal items JSON: %w", err)
+	}
+
+	return ord, nil
+}
+
 // This method should be called to cache the most recently-created orders but it may be useful somewhere else in the future
 //
 // if limit is nil then no limit is applied
@@ -130,71 +198,30 @@ func (p *PostgresStorage) GetAllOrders(ctx context.Context, limit *uint64) ([]mo
 
 	conn, err := p.pgxPool.Acquire(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("%s: failed to acquire connection: %w", op, err)
+		return nil, fmt.Errorf("%s: failed to acquire connection: %w", op, markTransient(err))
 	}
 	defer conn.Release()
 
 	rows, err := conn.Query(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("%s: failed to execute query: %w", op, err)
+		return nil, fmt.Errorf("%s: failed to execute query: %w", op, classifyErr(err))
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var ord models.Order
-		var itemsJSON []byte
-
-		err := rows.Scan(
-			&ord.OrderUID,
-			&ord.TrackNumber,
-			&ord.Entry,
-			&ord.Locale,
-			&ord.InternalSignature,
-			&ord.CustomerID,
-			&ord.DeliveryService,
-			&ord.Shardkey,
-			&ord.SmID,
-			&ord.DateCreated,
-			&ord.OofShard,
-
-			&ord.Delivery.DeliveryUID,
-			&ord.Delivery.Name,
-			&ord.Delivery.Phone,
-			&ord.Delivery.Zip,
-			&ord.Delivery.City,
-			&ord.Delivery.Address,
-			&ord.Delivery.Region,
-			&ord.Delivery.Email,
-
-			&ord.Payment.Transaction,
-			&ord.Payment.RequestID,
-			&ord.Payment.Currency,
-			&ord.Payment.Provider,
-			&ord.Payment.Amount,
-			&ord.Payment.PaymentDt,
-			&ord.Payment.Bank,
-			&ord.Payment.DeliveryCost,
-			&ord.Payment.GoodsTotal,
-			&ord.Payment.CustomFee,
-
-			&itemsJSON,
-		)
+		ord, err := scanOrder(rows)
 		if err != nil {
 			if errors.Is(err, sql.ErrNoRows) { // just in case someone will add filter logic
 				return nil, fmt.Errorf("%s: %w", op, models.ErrOrdersNotFound)
 			}
-			return nil, fmt.Errorf("%s: failed to scan rows: %w", op, err)
-		}
-
-		if err := json.Unmarshal(itemsJSON, &ord.Items); err != nil {
-			return nil, fmt.Errorf("%s: failed to unmarshal items JSON: %w", op, err)
+			return nil, fmt.Errorf("%s: failed to scan rows: %w", op, classifyErr(err))
 		}
 
 		orders = append(orders, ord)
 	}
 
 	if rows.Err() != nil {
-		return nil, fmt.Errorf("%s: rows err: %w", op, rows.Err())
+		return nil, fmt.Errorf("%s: rows err: %w", op, classifyErr(rows.Err()))
 	}
 
 	if len(orders) == 0 {
@@ -217,88 +244,203 @@ func (p *PostgresStorage) GetOrderById(ctx context.Context, id string) (models.O
 
 	conn, err := p.pgxPool.Acquire(ctx)
 	if err != nil {
-		return models.Order{}, fmt.Errorf("%s: failed to acquire connection: %w", op, err)
+		return models.Order{}, fmt.Errorf("%s: failed to acquire connection: %w", op, markTransient(err))
 	}
 	defer conn.Release()
 
-	row := conn.QueryRow(ctx, query, args...)
+	ord, err := scanOrder(conn.QueryRow(ctx, query, args...))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Order{}, fmt.Errorf("%s: %w", op, models.ErrOrdersNotFound)
+		}
+		return models.Order{}, fmt.Errorf("%s: failed to scan row: %w", op, classifyErr(err))
+	}
+
+	return ord, nil
+}
 
-	var ord models.Order
-	var itemsJSON []byte
+// ListOrders returns orders matching filter ordered by date_created DESC and order_uid DESC.
+//
+// if cursor is nil then listing starts from the most recent order, empty result is not an error
+func (p *PostgresStorage) ListOrders(ctx context.Context, filter models.OrderFilter, cursor *models.OrderCursor, limit uint64) ([]models.Order, error) {
+	op := common.GetOperationName()
 
-	err = row.Scan(
-		&ord.OrderUID,
-		&ord.TrackNumber,
-		&ord.Entry,
-		&ord.Locale,
-		&ord.InternalSignature,
-		&ord.CustomerID,
-		&ord.DeliveryService,
-		&ord.Shardkey,
-		&ord.SmID,
-		&ord.DateCreated,
-		&ord.OofShard,
+	queryBuilder := applyOrderFilter(orderQueryBase, filter).
+		OrderBy("orders.date_created DESC", "orders.order_uid DESC").
+		Limit(limit)
 
-		&ord.Delivery.DeliveryUID,
-		&ord.Delivery.Name,
-		&ord.Delivery.Phone,
-		&ord.Delivery.Zip,
-		&ord.Delivery.City,
-		&ord.Delivery.Address,
-		&ord.Delivery.Region,
-		&ord.Delivery.Email,
+	if cursor != nil {
+		queryBuilder = queryBuilder.Where("(orders.date_created, orders.order_uid) < (?, ?)", cursor.DateCreated, cursor.OrderUID)
+	}
 
-		&ord.Payment.Transaction,
-		&ord.Payment.RequestID,
-		&ord.Payment.Currency,
-		&ord.Payment.Provider,
-		&ord.Payment.Amount,
-		&ord.Payment.PaymentDt,
-		&ord.Payment.Bank,
-		&ord.Payment.DeliveryCost,
-		&ord.Payment.GoodsTotal,
-		&ord.Payment.CustomFee,
+	query, args, err := queryBuilder.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to build query: %w", op, err)
+	}
 
-		&itemsJSON,
-	)
+	conn, err := p.pgxPool.Acquire(ctx)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return models.Order{}, fmt.Errorf("%s: %w", op, models.ErrOrdersNotFound)
+		return nil, fmt.Errorf("%s: failed to acquire connection: %w", op, markTransient(err))
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to execute query: %w", op, classifyErr(err))
+	}
+	defer rows.Close()
+
+	orders := make([]models.Order, 0, limit)
+	for rows.Next() {
+		ord, err := scanOrder(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: failed to scan rows: %w", op, classifyErr(err))
 		}
-		return models.Order{}, fmt.Errorf("%s: failed to scan row: %w", op, err)
+
+		orders = append(orders, ord)
 	}
 
-	if err := json.Unmarshal(itemsJSON, &ord.Items); err != nil {
-		return models.Order{}, fmt.Errorf("%s: failed to unmarshal items JSON: %w", op, err)
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("%s: rows err: %w", op, classifyErr(rows.Err()))
 	}
 
-	return ord, nil
+	return orders, nil
+}
+
+func applyOrderFilter(queryBuilder sq.SelectBuilder, filter models.OrderFilter) sq.SelectBuilder {
+	if filter.CustomerID != "" {
+		queryBuilder = queryBuilder.Where(sq.Eq{"orders.customer_id": filter.CustomerID})
+	}
+	if filter.TrackNumber != "" {
+		queryBuilder = queryBuilder.Where(sq.Eq{"orders.track_number": filter.TrackNumber})
+	}
+	if filter.DeliveryService != "" {
+		queryBuilder = queryBuilder.Where(sq.Eq{"orders.delivery_service": filter.DeliveryService})
+	}
+	if filter.PaymentProvider != "" {
+		queryBuilder = queryBuilder.Where(sq.Eq{"payments.provider": filter.PaymentProvider})
+	}
+	if filter.Currency != "" {
+		queryBuilder = queryBuilder.Where(sq.Eq{"payments.currency": filter.Currency})
+	}
+	if filter.CreatedFrom != nil {
+		queryBuilder = queryBuilder.Where(sq.GtOrEq{"orders.date_created": *filter.CreatedFrom})
+	}
+	if filter.CreatedTo != nil {
+		queryBuilder = queryBuilder.Where(sq.Lt{"orders.date_created": *filter.CreatedTo})
+	}
+	return queryBuilder
 }
 
-func (p *PostgresStorage) SaveOrder(ctx context.Context, order models.Order) error {
+// SaveOrder is idempotent: saving an order identical to the existing one is treated as success,
+// saving a different order with the same order_uid returns models.ErrOrderConflict.
+//
+// It returns the stored order and whether it was created, for redelivered orders it is the existing one which may already have another status
+func (p *PostgresStorage) SaveOrder(ctx context.Context, order models.Order) (models.Order, bool, error) {
+	op := common.GetOperationName()
+
+	err := p.insertOrder(ctx, order)
+	if err == nil {
+		return order, true, nil
+	}
+	if !isUniqueViolation(err) {
+		return models.Order{}, false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// order might be redelivered, so compare it with the existing one
+	existing, getErr := p.GetOrderById(ctx, order.OrderUID)
+	if getErr != nil {
+		if errors.Is(getErr, models.ErrOrdersNotFound) {
+			// delivery, payment or item belongs to another order
+			return models.Order{}, false, fmt.Errorf("%s: %w: %w", op, models.ErrOrderConflict, err)
+		}
+		return models.Order{}, false, fmt.Errorf("%s: failed to get existing order: %w", op, getErr)
+	}
+
+	if !sameOrders(existing, order) {
+		return models.Order{}, false, fmt.Errorf("%s: %w", op, models.ErrOrderConflict)
+	}
+
+	return existing, false, nil
+}
+
+// SaveOrders saves all orders in one transaction, it is meant for bulk saving of micro-batches.
+//
+// Unlike SaveOrder it is not idempotent: if any order fails (including already existing ones) nothing is saved,
+// so callers should fall back to SaveOrder for every order to find out which one failed
+func (p *PostgresStorage) SaveOrders(ctx context.Context, orders []models.Order) error {
+	op := common.GetOperationName()
+
+	if len(orders) == 0 {
+		return nil
+	}
+
+	if err := p.insertOrders(ctx, orders...); err != nil {
+		if isUniqueViolation(err) {
+			return fmt.Errorf("%s: %w: %w", op, models.ErrOrderConflict, err)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (p *PostgresStorage) insertOrder(ctx context.Context, order models.Order) error {
+	return p.insertOrders(ctx, order)
+}
+
+// insertOrders sends all inserts in a single batch inside one transaction, so the whole batch costs one round-trip instead of one per row
+func (p *PostgresStorage) insertOrders(ctx context.Context, orders ...models.Order) error {
 	op := common.GetOperationName()
 
 	conn, err := p.pgxPool.Acquire(ctx)
 	if err != nil {
-		return fmt.Errorf("%s: failed to acquire connection: %w", op, err)
+		return fmt.Errorf("%s: failed to acquire connection: %w", op, markTransient(err))
 	}
 	defer conn.Release()
 
 	tx, err := conn.Begin(ctx)
 	if err != nil {
-		return fmt.Errorf("%s: failed to begin transaction: %w", op, err)
+		return fmt.Errorf("%s: failed to begin transaction: %w", op, classifyErr(err))
 	}
 	defer tx.Rollback(ctx)
 
-	_, err = tx.Exec(ctx, `
+	batch := &insertBatch{}
+	for _, order := range orders {
+		if err := batch.queueOrder(order); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := batch.exec(ctx, tx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("%s: failed to commit transaction: %w", op, classifyErr(err))
+	}
+
+	return nil
+}
+
+// insertBatch is a pgx.Batch that remembers what every queued query inserts, so errors can tell which insert failed
+type insertBatch struct {
+	batch  pgx.Batch
+	labels []string
+}
+
+func (b *insertBatch) queue(label, query string, args ...any) {
+	b.batch.Queue(query, args...)
+	b.labels = append(b.labels, label)
+}
+
+func (b *insertBatch) queueOrder(order models.Order) error {
+	b.queue("delivery", `
 	INSERT INTO deliveries (delivery_uid, name, phone, zip, city, address, region, email)
 	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 	`, order.Delivery.DeliveryUID, order.Delivery.Name, order.Delivery.Phone, order.Delivery.Zip, order.Delivery.City, order.Delivery.Address, order.Delivery.Region, order.Delivery.Email)
-	if err != nil {
-		return fmt.Errorf("%s: failed to insert delivery: %w", op, err)
-	}
 
-	_, err = tx.Exec(ctx,
+	b.queue("payment",
 		`INSERT INTO payments (transaction, request_id, currency, provider, amount, payment_dt, bank, delivery_cost, goods_total, custom_fee)
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
 		order.Payment.Transaction,
@@ -312,13 +454,10 @@ func (p *PostgresStorage) SaveOrder(ctx context.Context, order models.Order) err
 		order.Payment.GoodsTotal,
 		order.Payment.CustomFee,
 	)
-	if err != nil {
-		return fmt.Errorf("%s: failed to insert payment: %w", op, err)
-	}
 
-	_, err = tx.Exec(ctx, `
-	INSERT INTO orders (order_uid, track_number, entry, delivery_uid, payment_transaction, locale, internal_signature, customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard)
-	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`,
+	b.queue("order", `
+	INSERT INTO orders (order_uid, track_number, entry, delivery_uid, payment_transaction, locale, internal_signature, customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard, status)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)`,
 		order.OrderUID,
 		order.TrackNumber,
 		order.Entry,
@@ -331,18 +470,37 @@ func (p *PostgresStorage) SaveOrder(ctx context.Context, order models.Order) err
 		order.Shardkey,
 		order.SmID,
 		order.DateCreated,
-		order.OofShard)
+		order.OofShard,
+		order.Status)
+
+	// event is written in the same transaction, so it is published only if the order is saved
+	err := b.queueOutboxEvent(models.OrderEvent{
+		Type:       models.OrderEventCreated,
+		OrderUID:   order.OrderUID,
+		Status:     order.Status,
+		Order:      &order,
+		OccurredAt: time.Now().UTC(),
+	})
 	if err != nil {
-		return fmt.Errorf("%s: failed to insert order: %w", op, err)
+		return err
+	}
+
+	if len(order.Items) == 0 {
+		return nil
 	}
 
+	// all items of the order are inserted with one multi-row statement
+	itemsInsert := sq.StatementBuilder.
+		PlaceholderFormat(sq.Dollar).
+		Insert("items").
+		Columns("chrt_id", "track_number", "price", "rid", "name", "sale", "size", "total_price", "nm_id", "brand", "status")
+	orderItemsInsert := sq.StatementBuilder.
+		PlaceholderFormat(sq.Dollar).
+		Insert("order_items").
+		Columns("order_uid", "chrt_id")
+
 	for _, item := range order.Items {
-		_, err = tx.Exec(ctx, `
-		INSERT INTO items (
-			chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status
-		)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
-		`,
+		itemsInsert = itemsInsert.Values(
 			item.ChrtID,
 			item.TrackNumber,
 			item.Price,
@@ -355,20 +513,94 @@ func (p *PostgresStorage) SaveOrder(ctx context.Context, order models.Order) err
 			item.Brand,
 			item.Status,
 		)
-		if err != nil {
-			return fmt.Errorf("%s: failed to insert item: %w", op, err)
+		orderItemsInsert = orderItemsInsert.Values(order.OrderUID, item.ChrtID)
+	}
+
+	query, args, err := itemsInsert.ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build items query: %w", err)
+	}
+	b.queue("items", query, args...)
+
+	query, args, err = orderItemsInsert.ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build order_items query: %w", err)
+	}
+	b.queue("order_items", query, args...)
+
+	return nil
+}
+
+// exec sends the batch and returns the first failed insert
+func (b *insertBatch) exec(ctx context.Context, tx pgx.Tx) error {
+	results := tx.SendBatch(ctx, &b.batch)
+	defer results.Close()
+
+	for _, label := range b.labels {
+		if _, err := results.Exec(); err != nil {
+			return fmt.Errorf("failed to insert %s: %w", label, classifyErr(err))
 		}
-		_, err = tx.Exec(ctx, `
-		INSERT INTO order_items (order_uid, chrt_id)
-		VALUES ($1, $2)
-		`,
-			order.OrderUID,
-			item.ChrtID,
-		)
+	}
+
+	if err := results.Close(); err != nil {
+		return fmt.Errorf("failed to close batch: %w", classifyErr(err))
+	}
+	return nil
+}
+
+// UpdateOrderStatus changes order status only if the current one is equal to from, so concurrent changes are not lost.
+//
+// order.updated event is written to the outbox in the same transaction
+func (p *PostgresStorage) UpdateOrderStatus(ctx context.Context, id string, from, to models.OrderStatus) error {
+	op := common.GetOperationName()
+
+	conn, err := p.pgxPool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: failed to acquire connection: %w", op, markTransient(err))
+	}
+	defer conn.Release()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: failed to begin transaction: %w", op, classifyErr(err))
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `UPDATE orders SET status = $1 WHERE order_uid = $2 AND status = $3`, to, id, from)
+	if err != nil {
+		return fmt.Errorf("%s: failed to update order status: %w", op, classifyErr(err))
+	}
+
+	if tag.RowsAffected() == 0 {
+		var exists bool
+		err = tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM orders WHERE order_uid = $1)`, id).Scan(&exists)
 		if err != nil {
-			return fmt.Errorf("%s: failed to insert order_item: %w", op, err)
+			return fmt.Errorf("%s: failed to check order existence: %w", op, classifyErr(err))
+		}
+		if !exists {
+			return fmt.Errorf("%s: %w", op, models.ErrOrdersNotFound)
 		}
+		return fmt.Errorf("%s: %w", op, models.ErrConcurrentStatusChange)
+	}
+
+	batch := &insertBatch{}
+	err = batch.queueOutboxEvent(models.OrderEvent{
+		Type:           models.OrderEventUpdated,
+		OrderUID:       id,
+		Status:         to,
+		PreviousStatus: from,
+		OccurredAt:     time.Now().UTC(),
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err := batch.exec(ctx, tx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("%s: failed to commit transaction: %w", op, classifyErr(err))
 	}
 
-	return tx.Commit(ctx)
+	return nil
 }
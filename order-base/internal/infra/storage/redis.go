@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Util787/order-base/internal/common"
+	"github.com/Util787/order-base/internal/config"
+	"github.com/Util787/order-base/internal/models"
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStorage is a cache shared between replicas, orders are stored as JSON
+type RedisStorage struct {
+	client    *redis.Client
+	keyPrefix string
+}
+
+func MustInitRedis(ctx context.Context, cfg config.RedisConfig) RedisStorage {
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Host + ":" + strconv.Itoa(cfg.Port),
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	})
+
+	if err := client.Ping(ctx).Err(); err != nil {
+		panic(fmt.Errorf("failed to ping redis: %w", err))
+	}
+
+	return RedisStorage{
+		client:    client,
+		keyPrefix: cfg.KeyPrefix,
+	}
+}
+
+func (r *RedisStorage) Shutdown() error {
+	return r.client.Close()
+}
+
+func (r *RedisStorage) Ping(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
+}
+
+// If ttl is nil then no ttl will be set
+func (r *RedisStorage) CacheOrder(ctx context.Context, key string, order models.Order, ttl *time.Duration) error {
+	op := common.GetOperationName()
+
+	value, err := json.Marshal(order)
+	if err != nil {
+		return fmt.Errorf("%s: failed to marshal order: %w", op, err)
+	}
+
+	var expiration time.Duration // 0 means no expiration in redis
+	if ttl != nil {
+		expiration = *ttl
+	}
+
+	if err := r.client.Set(ctx, r.keyPrefix+key, value, expiration).Err(); err != nil {
+		return fmt.Errorf("%s: failed to set order: %w", op, err)
+	}
+	return nil
+}
+
+func (r *RedisStorage) GetOrder(ctx context.Context, key string) (models.Order, error) {
+	op := common.GetOperationName()
+
+	value, err := r.client.Get(ctx, r.keyPrefix+key).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return models.Order{}, fmt.Errorf("%s: %w", op, models.ErrOrdersNotFound)
+		}
+		return models.Order{}, fmt.Errorf("%s: failed to get order: %w", op, err)
+	}
+
+	var order models.Order
+	if err := json.Unmarshal(value, &order); err != nil {
+		return models.Order{}, fmt.Errorf("%s: failed to unmarshal order: %w", op, err)
+	}
+	return order, nil
+}
+
+func (r *RedisStorage) DeleteOrder(ctx context.Context, key string) error {
+	op := common.GetOperationName()
+
+	if err := r.client.Del(ctx, r.keyPrefix+key).Err(); err != nil {
+		return fmt.Errorf("%s: failed to delete order: %w", op, err)
+	}
+	return nil
+}
+
+// keys are scanned and deleted in pages of this size, so Clear doesnt block redis for long
+const clearScanCount = 1000
+
+// Clear deletes all orders, i.e. keys with the key prefix, and returns the number of deleted orders.
+// Keys are scanned, so orders cached concurrently may be left.
+//
+// Clear refuses to run without key prefix since every key of the db would be deleted
+func (r *RedisStorage) Clear(ctx context.Context) (int, error) {
+	op := common.GetOperationName()
+
+	if r.keyPrefix == "" {
+		return 0, fmt.Errorf("%s: key prefix is not set, refusing to delete all keys of the db", op)
+	}
+	pattern := escapeGlob(r.keyPrefix) + "*"
+
+	deleted := 0
+	var cursor uint64
+	for {
+		keys, next, err := r.client.Scan(ctx, cursor, pattern, clearScanCount).Result()
+		if err != nil {
+			return deleted, fmt.Errorf("%s: failed to scan orders: %w", op, err)
+		}
+
+		if len(keys) > 0 {
+			n, err := r.client.Del(ctx, keys...).Result()
+			if err != nil {
+				return deleted, fmt.Errorf("%s: failed to delete orders: %w", op, err)
+			}
+			deleted += int(n)
+		}
+
+		if next == 0 {
+			return deleted, nil
+		}
+		cursor = next
+	}
+}
+
+// escapeGlob escapes characters of s that have special meaning in redis glob-style patterns
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		switch c {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
@@ -0,0 +1,198 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Util787/order-base/internal/config"
+	"github.com/Util787/order-base/internal/models"
+	"github.com/alicebob/miniredis/v2"
+)
+
+const testKeyPrefix = "order:"
+
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, *RedisStorage) {
+	t.Helper()
+	return newTestRedisWithPrefix(t, testKeyPrefix)
+}
+
+func newTestRedisWithPrefix(t *testing.T, keyPrefix string) (*miniredis.Miniredis, *RedisStorage) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	port, err := strconv.Atoi(mr.Port())
+	if err != nil {
+		t.Fatalf("failed to parse miniredis port: %v", err)
+	}
+
+	strg := MustInitRedis(context.Background(), config.RedisConfig{Host: mr.Host(), Port: port, KeyPrefix: keyPrefix})
+	t.Cleanup(func() { strg.Shutdown() })
+	return mr, &strg
+}
+
+func TestRedisStorage_CacheOrder(t *testing.T) {
+	ctx := context.Background()
+	mr, strg := newTestRedis(t)
+	order := testOrder(1)
+
+	if err := strg.CacheOrder(ctx, order.OrderUID, order, nil); err != nil {
+		t.Fatalf("CacheOrder() error = %v", err)
+	}
+
+	if !mr.Exists(testKeyPrefix + order.OrderUID) {
+		t.Fatalf("key %q is not set", testKeyPrefix+order.OrderUID)
+	}
+	got, err := strg.GetOrder(ctx, order.OrderUID)
+	if err != nil {
+		t.Fatalf("GetOrder() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, order) {
+		t.Errorf("GetOrder() = %+v, want %+v", got, order)
+	}
+}
+
+func TestRedisStorage_TTL(t *testing.T) {
+	ctx := context.Background()
+	mr, strg := newTestRedis(t)
+	order := testOrder(1)
+	ttl := 10 * time.Second
+
+	if err := strg.CacheOrder(ctx, order.OrderUID, order, &ttl); err != nil {
+		t.Fatalf("CacheOrder() error = %v", err)
+	}
+	if got := mr.TTL(testKeyPrefix + order.OrderUID); got != ttl {
+		t.Errorf("ttl = %v, want %v", got, ttl)
+	}
+
+	mr.FastForward(ttl + time.Second)
+
+	if _, err := strg.GetOrder(ctx, order.OrderUID); !errors.Is(err, models.ErrOrdersNotFound) {
+		t.Errorf("GetOrder() after ttl error = %v, want %v", err, models.ErrOrdersNotFound)
+	}
+}
+
+func TestRedisStorage_NilTTL(t *testing.T) {
+	ctx := context.Background()
+	mr, strg := newTestRedis(t)
+	order := testOrder(1)
+
+	if err := strg.CacheOrder(ctx, order.OrderUID, order, nil); err != nil {
+		t.Fatalf("CacheOrder() error = %v", err)
+	}
+	// miniredis returns 0 for keys without expiration
+	if got := mr.TTL(testKeyPrefix + order.OrderUID); got != 0 {
+		t.Errorf("ttl = %v, want no expiration", got)
+	}
+
+	mr.FastForward(24 * time.Hour)
+
+	if _, err := strg.GetOrder(ctx, order.OrderUID); err != nil {
+		t.Errorf("GetOrder() error = %v", err)
+	}
+}
+
+func TestRedisStorage_DeleteOrder(t *testing.T) {
+	ctx := context.Background()
+	mr, strg := newTestRedis(t)
+	order := testOrder(1)
+
+	if err := strg.CacheOrder(ctx, order.OrderUID, order, nil); err != nil {
+		t.Fatalf("CacheOrder() error = %v", err)
+	}
+	if err := strg.DeleteOrder(ctx, order.OrderUID); err != nil {
+		t.Fatalf("DeleteOrder() error = %v", err)
+	}
+
+	if mr.Exists(testKeyPrefix + order.OrderUID) {
+		t.Errorf("key %q is not deleted", testKeyPrefix+order.OrderUID)
+	}
+	if _, err := strg.GetOrder(ctx, order.OrderUID); !errors.Is(err, models.ErrOrdersNotFound) {
+		t.Errorf("GetOrder() error = %v, want %v", err, models.ErrOrdersNotFound)
+	}
+	// deleting missing order is not an error
+	if err := strg.DeleteOrder(ctx, order.OrderUID); err != nil {
+		t.Errorf("DeleteOrder() of missing order error = %v", err)
+	}
+}
+
+func TestRedisStorage_GetOrderUnavailable(t *testing.T) {
+	ctx := context.Background()
+	mr, strg := newTestRedis(t)
+
+	mr.SetError("LOADING")
+
+	_, err := strg.GetOrder(ctx, "missing")
+	if err == nil || errors.Is(err, models.ErrOrdersNotFound) {
+		t.Errorf("GetOrder() error = %v, want redis error", err)
+	}
+}
+
+func TestRedisStorage_Clear(t *testing.T) {
+	ctx := context.Background()
+	mr, strg := newTestRedis(t)
+
+	const cached = 2500 // more than one scan page
+	for i := range cached {
+		order := testOrder(i)
+		if err := strg.CacheOrder(ctx, order.OrderUID, order, nil); err != nil {
+			t.Fatalf("CacheOrder() error = %v", err)
+		}
+	}
+	mr.Set("other", "value")
+
+	deleted, err := strg.Clear(ctx)
+	if err != nil {
+		t.Fatalf("Clear() error = %v", err)
+	}
+	if deleted != cached {
+		t.Errorf("Clear() = %d, want %d", deleted, cached)
+	}
+	if keys := mr.Keys(); len(keys) != 1 || keys[0] != "other" {
+		t.Errorf("keys after Clear() = %v, want only keys without prefix", keys)
+	}
+}
+
+func TestRedisStorage_ClearEmptyPrefix(t *testing.T) {
+	ctx := context.Background()
+	mr, strg := newTestRedisWithPrefix(t, "")
+	order := testOrder(1)
+
+	if err := strg.CacheOrder(ctx, order.OrderUID, order, nil); err != nil {
+		t.Fatalf("CacheOrder() error = %v", err)
+	}
+	mr.Set("other", "value")
+
+	if _, err := strg.Clear(ctx); err == nil {
+		t.Fatal("Clear() error = nil, want error for empty key prefix")
+	}
+	if keys := mr.Keys(); len(keys) != 2 {
+		t.Errorf("keys after Clear() = %v, want all keys kept", keys)
+	}
+}
+
+func TestRedisStorage_ClearGlobPrefix(t *testing.T) {
+	ctx := context.Background()
+	mr, strg := newTestRedisWithPrefix(t, "ord?r[1]:")
+	order := testOrder(1)
+
+	if err := strg.CacheOrder(ctx, order.OrderUID, order, nil); err != nil {
+		t.Fatalf("CacheOrder() error = %v", err)
+	}
+	// matched by the prefix if it was used as pattern unescaped
+	mr.Set("order1:other", "value")
+
+	deleted, err := strg.Clear(ctx)
+	if err != nil {
+		t.Fatalf("Clear() error = %v", err)
+	}
+	if deleted != 1 {
+		t.Errorf("Clear() = %d, want 1", deleted)
+	}
+	if keys := mr.Keys(); len(keys) != 1 || keys[0] != "order1:other" {
+		t.Errorf("keys after Clear() = %v, want only keys without prefix", keys)
+	}
+}
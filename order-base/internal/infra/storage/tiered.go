@@ -0,0 +1,150 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Util787/order-base/internal/common"
+	"github.com/Util787/order-base/internal/models"
+)
+
+type cacheStorage interface {
+	GetOrder(ctx context.Context, key string) (models.Order, error)
+	CacheOrder(ctx context.Context, key string, order models.Order, ttl *time.Duration) error
+	DeleteOrder(ctx context.Context, key string) error
+}
+
+// TieredStorage keeps a fast local cache in front of a shared one (e.g. InMemoryStorage in front of RedisStorage)
+type TieredStorage struct {
+	local    cacheStorage
+	shared   cacheStorage
+	localTTL time.Duration // orders are kept locally not longer than localTTL so changes made by other replicas are picked up
+}
+
+func NewTieredStorage(local, shared cacheStorage, localTTL time.Duration) TieredStorage {
+	return TieredStorage{
+		local:    local,
+		shared:   shared,
+		localTTL: localTTL,
+	}
+}
+
+func (t *TieredStorage) CacheOrder(ctx context.Context, key string, order models.Order, ttl *time.Duration) error {
+	op := common.GetOperationName()
+
+	if err := t.shared.CacheOrder(ctx, key, order, ttl); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err := t.local.CacheOrder(ctx, key, order, t.localTTLFor(ttl)); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (t *TieredStorage) GetOrder(ctx context.Context, key string) (models.Order, error) {
+	op := common.GetOperationName()
+
+	order, err := t.local.GetOrder(ctx, key)
+	if err == nil {
+		return order, nil
+	}
+	if !errors.Is(err, models.ErrOrdersNotFound) {
+		return models.Order{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	order, err = t.shared.GetOrder(ctx, key)
+	if err != nil {
+		return models.Order{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := t.local.CacheOrder(ctx, key, order, &t.localTTL); err != nil {
+		return models.Order{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return order, nil
+}
+
+func (t *TieredStorage) DeleteOrder(ctx context.Context, key string) error {
+	op := common.GetOperationName()
+
+	// shared first so the local cache cant be refilled with the deleted order
+	if err := t.shared.DeleteOrder(ctx, key); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err := t.local.DeleteOrder(ctx, key); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// Clear deletes all orders from both caches, shared first for the same reason as in DeleteOrder.
+// It returns the number of orders deleted from the shared cache since local one holds only copies of them
+func (t *TieredStorage) Clear(ctx context.Context) (int, error) {
+	op := common.GetOperationName()
+
+	shared, ok := t.shared.(interface {
+		Clear(ctx context.Context) (int, error)
+	})
+	if !ok {
+		return 0, fmt.Errorf("%s: shared cache cant be cleared", op)
+	}
+	deleted, err := shared.Clear(ctx)
+	if err != nil {
+		return deleted, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if local, ok := t.local.(interface {
+		Clear(ctx context.Context) (int, error)
+	}); ok {
+		if _, err := local.Clear(ctx); err != nil {
+			return deleted, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	return deleted, nil
+}
+
+// Stats returns stats of the local cache if it is InMemoryStorage, shared cache has no stats
+func (t *TieredStorage) Stats() CacheStats {
+	local, ok := t.local.(interface{ Stats() CacheStats })
+	if !ok {
+		return CacheStats{}
+	}
+	return local.Stats()
+}
+
+// Entry returns the local copy of the order if local cache is InMemoryStorage
+func (t *TieredStorage) Entry(key string) (CacheEntry, bool) {
+	local, ok := t.local.(interface {
+		Entry(key string) (CacheEntry, bool)
+	})
+	if !ok {
+		return CacheEntry{}, false
+	}
+	return local.Entry(key)
+}
+
+func (t *TieredStorage) localTTLFor(ttl *time.Duration) *time.Duration {
+	if ttl != nil && *ttl < t.localTTL {
+		return ttl
+	}
+	return &t.localTTL
+}
+
+// GetStaleOrder reads stale orders only from the local cache, see InMemoryStorage.GetStaleOrder
+func (t *TieredStorage) GetStaleOrder(ctx context.Context, key string) (models.Order, error) {
+	op := common.GetOperationName()
+
+	staleCache, ok := t.local.(interface {
+		GetStaleOrder(ctx context.Context, key string) (models.Order, error)
+	})
+	if !ok {
+		return models.Order{}, fmt.Errorf("%s: %w", op, models.ErrOrdersNotFound)
+	}
+
+	order, err := staleCache.GetStaleOrder(ctx, key)
+	if err != nil {
+		return models.Order{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return order, nil
+}
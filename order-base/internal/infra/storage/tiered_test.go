@@ -0,0 +1,194 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Util787/order-base/internal/models"
+)
+
+// recordingStorage records calls of the wrapped storage so the order of calls between tiers can be checked
+type recordingStorage struct {
+	cacheStorage
+	name  string
+	calls *[]string
+}
+
+func (r recordingStorage) DeleteOrder(ctx context.Context, key string) error {
+	*r.calls = append(*r.calls, r.name+".DeleteOrder")
+	return r.cacheStorage.DeleteOrder(ctx, key)
+}
+
+func newTestTiered(t *testing.T, localTTL time.Duration) (*TieredStorage, *InMemoryStorage, *RedisStorage) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	_, shared := newTestRedis(t)
+	local := NewInMemoryStorage(ctx, 16, time.Hour)
+	tiered := NewTieredStorage(local, shared, localTTL)
+	return &tiered, local, shared
+}
+
+func TestTieredStorage_GetOrderReadThrough(t *testing.T) {
+	ctx := context.Background()
+	localTTL := 5 * time.Second
+	tiered, local, shared := newTestTiered(t, localTTL)
+	order := testOrder(1)
+
+	// cached by another replica
+	if err := shared.CacheOrder(ctx, order.OrderUID, order, nil); err != nil {
+		t.Fatalf("CacheOrder() error = %v", err)
+	}
+	if _, found := local.Entry(order.OrderUID); found {
+		t.Fatal("order is in local cache before read")
+	}
+
+	got, err := tiered.GetOrder(ctx, order.OrderUID)
+	if err != nil {
+		t.Fatalf("GetOrder() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, order) {
+		t.Errorf("GetOrder() = %+v, want %+v", got, order)
+	}
+
+	entry, found := local.Entry(order.OrderUID)
+	if !found {
+		t.Fatal("order is not refilled to local cache")
+	}
+	if entry.ExpiresAt == nil || time.Until(*entry.ExpiresAt) > localTTL {
+		t.Errorf("local expiration = %v, want not later than %v", entry.ExpiresAt, localTTL)
+	}
+}
+
+func TestTieredStorage_GetOrderNotFound(t *testing.T) {
+	tiered, _, _ := newTestTiered(t, 5*time.Second)
+
+	if _, err := tiered.GetOrder(context.Background(), "missing"); !errors.Is(err, models.ErrOrdersNotFound) {
+		t.Errorf("GetOrder() error = %v, want %v", err, models.ErrOrdersNotFound)
+	}
+}
+
+func TestTieredStorage_CacheOrderLocalTTL(t *testing.T) {
+	ctx := context.Background()
+	localTTL := 5 * time.Second
+	tiered, local, shared := newTestTiered(t, localTTL)
+
+	tests := []struct {
+		name        string
+		ttl         *time.Duration
+		wantLocalAt time.Duration
+	}{
+		{"no ttl", nil, localTTL},
+		{"longer than local ttl", durationPtr(time.Minute), localTTL},
+		{"shorter than local ttl", durationPtr(2 * time.Second), 2 * time.Second},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := testOrder(i)
+			if err := tiered.CacheOrder(ctx, order.OrderUID, order, tt.ttl); err != nil {
+				t.Fatalf("CacheOrder() error = %v", err)
+			}
+
+			if _, err := shared.GetOrder(ctx, order.OrderUID); err != nil {
+				t.Errorf("shared GetOrder() error = %v", err)
+			}
+
+			entry, found := local.Entry(order.OrderUID)
+			if !found {
+				t.Fatal("order is not in local cache")
+			}
+			// expiration is stored with second precision
+			until := time.Until(*entry.ExpiresAt)
+			if until > tt.wantLocalAt || until < tt.wantLocalAt-2*time.Second {
+				t.Errorf("local expires in %v, want %v", until, tt.wantLocalAt)
+			}
+		})
+	}
+}
+
+func TestTieredStorage_DeleteOrder(t *testing.T) {
+	ctx := context.Background()
+	tiered, local, shared := newTestTiered(t, 5*time.Second)
+	order := testOrder(1)
+
+	var calls []string
+	tiered.local = recordingStorage{cacheStorage: local, name: "local", calls: &calls}
+	tiered.shared = recordingStorage{cacheStorage: shared, name: "shared", calls: &calls}
+
+	if err := tiered.CacheOrder(ctx, order.OrderUID, order, nil); err != nil {
+		t.Fatalf("CacheOrder() error = %v", err)
+	}
+	if err := tiered.DeleteOrder(ctx, order.OrderUID); err != nil {
+		t.Fatalf("DeleteOrder() error = %v", err)
+	}
+
+	// shared first so concurrent reads cant refill local cache from shared one
+	wantCalls := []string{"shared.DeleteOrder", "local.DeleteOrder"}
+	if !reflect.DeepEqual(calls, wantCalls) {
+		t.Errorf("calls = %v, want %v", calls, wantCalls)
+	}
+	if _, err := tiered.GetOrder(ctx, order.OrderUID); !errors.Is(err, models.ErrOrdersNotFound) {
+		t.Errorf("GetOrder() after delete error = %v, want %v", err, models.ErrOrdersNotFound)
+	}
+}
+
+func TestTieredStorage_DeleteOrderSharedFailure(t *testing.T) {
+	ctx := context.Background()
+	tiered, local, _ := newTestTiered(t, 5*time.Second)
+	mr, shared := newTestRedis(t)
+	tiered.shared = shared
+	order := testOrder(1)
+
+	if err := tiered.CacheOrder(ctx, order.OrderUID, order, nil); err != nil {
+		t.Fatalf("CacheOrder() error = %v", err)
+	}
+
+	mr.SetError("LOADING")
+
+	if err := tiered.DeleteOrder(ctx, order.OrderUID); err == nil {
+		t.Fatal("DeleteOrder() error = nil, want shared storage error")
+	}
+	// local copy is kept since deleting only it would be undone by the next read from shared cache
+	if _, found := local.Entry(order.OrderUID); !found {
+		t.Error("order is deleted from local cache after shared cache failure")
+	}
+}
+
+func TestTieredStorage_Clear(t *testing.T) {
+	ctx := context.Background()
+	tiered, local, shared := newTestTiered(t, 5*time.Second)
+
+	for i := range 3 {
+		order := testOrder(i)
+		if err := tiered.CacheOrder(ctx, order.OrderUID, order, nil); err != nil {
+			t.Fatalf("CacheOrder() error = %v", err)
+		}
+	}
+
+	deleted, err := tiered.Clear(ctx)
+	if err != nil {
+		t.Fatalf("Clear() error = %v", err)
+	}
+	if deleted != 3 {
+		t.Errorf("Clear() = %d, want 3", deleted)
+	}
+	for i := range 3 {
+		order := testOrder(i)
+		if _, err := shared.GetOrder(ctx, order.OrderUID); !errors.Is(err, models.ErrOrdersNotFound) {
+			t.Errorf("shared GetOrder() error = %v, want %v", err, models.ErrOrdersNotFound)
+		}
+		if _, found := local.Entry(order.OrderUID); found {
+			t.Errorf("order %s is left in local cache", order.OrderUID)
+		}
+	}
+}
+
+func durationPtr(d time.Duration) *time.Duration {
+	return &d
+}
@@ -0,0 +1,94 @@
+package metrics
+
+import (
+	"github.com/Util787/order-base/internal/infra/storage"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/segmentio/kafka-go"
+)
+
+// RegisterInMemoryCache exposes InMemoryStorage stats, they are read on every scrape
+func RegisterInMemoryCache(statsFunc func() storage.CacheStats) {
+	counter := func(name, help string, value func(storage.CacheStats) uint64) prometheus.Collector {
+		return prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: namespace, Subsystem: "cache", Name: name, Help: help,
+		}, func() float64 { return float64(value(statsFunc())) })
+	}
+	gauge := func(name, help string, value func(storage.CacheStats) int64) prometheus.Collector {
+		return prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace, Subsystem: "cache", Name: name, Help: help,
+		}, func() float64 { return float64(value(statsFunc())) })
+	}
+
+	prometheus.MustRegister(
+		counter("hits_total", "Number of cache hits.", func(s storage.CacheStats) uint64 { return s.Hits }),
+		counter("misses_total", "Number of cache misses.", func(s storage.CacheStats) uint64 { return s.Misses }),
+		counter("evictions_total", "Number of orders evicted because of cache limits.", func(s storage.CacheStats) uint64 { return s.Evictions }),
+		gauge("entries", "Number of cached orders.", func(s storage.CacheStats) int64 { return int64(s.Entries) }),
+		gauge("bytes", "Approximate size of cached orders.", func(s storage.CacheStats) int64 { return s.Bytes }),
+	)
+}
+
+// RegisterPostgresPool exposes pgxpool stats, they are read on every scrape
+func RegisterPostgresPool(statFunc func() *pgxpool.Stat) {
+	prometheus.MustRegister(&pgxPoolCollector{statFunc: statFunc})
+}
+
+var (
+	pgxPoolAcquiredConns   = newPoolDesc("acquired_conns", "Number of currently acquired connections.")
+	pgxPoolIdleConns       = newPoolDesc("idle_conns", "Number of currently idle connections.")
+	pgxPoolTotalConns      = newPoolDesc("total_conns", "Total number of connections in the pool.")
+	pgxPoolMaxConns        = newPoolDesc("max_conns", "Maximum size of the pool.")
+	pgxPoolAcquireTotal    = newPoolDesc("acquire_total", "Number of successful acquires from the pool.")
+	pgxPoolAcquireSeconds  = newPoolDesc("acquire_duration_seconds_total", "Total duration of successful acquires from the pool.")
+	pgxPoolEmptyAcquire    = newPoolDesc("empty_acquire_total", "Number of acquires that waited for a connection because the pool was empty.")
+	pgxPoolCanceledAcquire = newPoolDesc("canceled_acquire_total", "Number of acquires canceled by context.")
+)
+
+func newPoolDesc(name, help string) *prometheus.Desc {
+	return prometheus.NewDesc(prometheus.BuildFQName(namespace, "postgres_pool", name), help, nil, nil)
+}
+
+type pgxPoolCollector struct {
+	statFunc func() *pgxpool.Stat
+}
+
+func (c *pgxPoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- pgxPoolAcquiredConns
+	ch <- pgxPoolIdleConns
+	ch <- pgxPoolTotalConns
+	ch <- pgxPoolMaxConns
+	ch <- pgxPoolAcquireTotal
+	ch <- pgxPoolAcquireSeconds
+	ch <- pgxPoolEmptyAcquire
+	ch <- pgxPoolCanceledAcquire
+}
+
+func (c *pgxPoolCollector) Collect(ch chan<- prometheus.Metric) {
+	stat := c.statFunc()
+
+	ch <- prometheus.MustNewConstMetric(pgxPoolAcquiredConns, prometheus.GaugeValue, float64(stat.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(pgxPoolIdleConns, prometheus.GaugeValue, float64(stat.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(pgxPoolTotalConns, prometheus.GaugeValue, float64(stat.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(pgxPoolMaxConns, prometheus.GaugeValue, float64(stat.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(pgxPoolAcquireTotal, prometheus.CounterValue, float64(stat.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(pgxPoolAcquireSeconds, prometheus.CounterValue, stat.AcquireDuration().Seconds())
+	ch <- prometheus.MustNewConstMetric(pgxPoolEmptyAcquire, prometheus.CounterValue, float64(stat.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(pgxPoolCanceledAcquire, prometheus.CounterValue, float64(stat.CanceledAcquireCount()))
+}
+
+// RegisterKafkaReader exposes kafka reader stats.
+//
+// kafka.Reader resets its counters on every Stats call so only gauges are taken from it, counters are collected by handlers
+func RegisterKafkaReader(statsFunc func() kafka.ReaderStats) {
+	gauge := func(name, help string, value func(kafka.ReaderStats) int64) prometheus.Collector {
+		return prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace, Subsystem: "kafka", Name: name, Help: help,
+		}, func() float64 { return float64(value(statsFunc())) })
+	}
+
+	prometheus.MustRegister(
+		gauge("consumer_lag", "Consumer lag of the reader.", func(s kafka.ReaderStats) int64 { return s.Lag }),
+		gauge("queue_length", "Number of messages fetched by the reader and waiting to be read.", func(s kafka.ReaderStats) int64 { return s.QueueLength }),
+	)
+}
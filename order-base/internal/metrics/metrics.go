@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "order_base"
+
+// kafka message results
+const (
+	KafkaResultFetched      = "fetched"
+	KafkaResultSaved        = "saved"
+	KafkaResultFailed       = "failed"
+	KafkaResultDeadLettered = "dead_lettered"
+	KafkaResultDropped      = "dropped" // failed and not dead-lettered because dead-letter topic is not configured
+	KafkaResultRetried      = "retried"
+)
+
+var (
+	HTTPRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "Number of handled HTTP requests.",
+	}, []string{"route", "method", "status"})
+
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Duration of handled HTTP requests.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	KafkaMessagesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "kafka",
+		Name:      "messages_total",
+		Help:      "Number of Kafka messages by handling result.",
+	}, []string{"result"})
+
+	// result is one of KafkaResultSaved, KafkaResultDeadLettered, KafkaResultDropped or KafkaResultFailed (left uncommitted)
+	KafkaHandleDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "kafka",
+		Name:      "handle_duration_seconds",
+		Help:      "Duration of handling a Kafka message including retries by handling result, messages of a batch are observed with the batch duration.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"result"})
+
+	KafkaBatchSize = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "kafka",
+		Name:      "batch_size",
+		Help:      "Number of messages in handled micro-batches.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 10),
+	})
+
+	KafkaBlockedPartitions = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "kafka",
+		Name:      "blocked_partitions",
+		Help:      "Number of partitions whose handling is stopped until their failed message is handled.",
+	})
+
+	OutboxEventsPublishedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "outbox",
+		Name:      "events_published_total",
+		Help:      "Number of order events published from the outbox by event type.",
+	}, []string{"type"})
+)
@@ -1,12 +1,13 @@
 package models
 
+// personal data is marked with pii tag, see redact package
 type Delivery struct {
 	DeliveryUID string `json:"delivery_uid" db:"delivery_uid"`
-	Name        string `json:"name" db:"name"`
-	Phone       string `json:"phone" db:"phone"`
-	Zip         string `json:"zip" db:"zip"`
+	Name        string `json:"name" db:"name" pii:"name"`
+	Phone       string `json:"phone" db:"phone" pii:"phone"`
+	Zip         string `json:"zip" db:"zip" pii:"address"`
 	City        string `json:"city" db:"city"`
-	Address     string `json:"address" db:"address"`
+	Address     string `json:"address" db:"address" pii:"address"`
 	Region      string `json:"region" db:"region"`
-	Email       string `json:"email" db:"email"`
+	Email       string `json:"email" db:"email" pii:"email"`
 }
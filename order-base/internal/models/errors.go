@@ -3,6 +3,7 @@ package models
 import (
 	"errors"
 	"fmt"
+	"strings"
 )
 
 var (
@@ -14,5 +15,51 @@ var (
 // Any validation error should contain this abstraction
 var ErrValidation = errors.New("validation error")
 var (
-	ErrInvalidOrderId = fmt.Errorf("%w: invalid order id", ErrValidation)
+	ErrInvalidOrderId     = fmt.Errorf("%w: invalid order id", ErrValidation)
+	ErrInvalidOrderStatus = fmt.Errorf("%w: invalid order status", ErrValidation)
+
+	ErrUnsupportedContentType = fmt.Errorf("%w: unsupported content type", ErrValidation)
+	ErrUnknownSchemaVersion   = fmt.Errorf("%w: unknown schema version", ErrValidation)
+)
+
+// ErrConflict is an abstraction that should be used only to get right status code in handlers
+//
+// Any error about data that conflicts with already stored one should contain this abstraction
+var ErrConflict = errors.New("conflict")
+var (
+	ErrOrderConflict           = fmt.Errorf("%w: order conflicts with the existing one", ErrConflict)
+	ErrInvalidStatusTransition = fmt.Errorf("%w: invalid order status transition", ErrConflict)
+	ErrConcurrentStatusChange  = fmt.Errorf("%w: order status was changed concurrently", ErrConflict)
 )
+
+// ErrTransient is an abstraction that marks errors which may disappear on retry (connection failures, serialization errors, timeouts)
+//
+// Storages should wrap such errors with it so callers can decide whether to retry
+var ErrTransient = errors.New("transient error")
+
+// FieldError describes a single invalid field, Field is a json path of it (e.g. "items[0].price")
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationErrors contains all invalid fields of the validated entity, it always wraps ErrValidation
+type ValidationErrors []FieldError
+
+func (v ValidationErrors) Error() string {
+	var b strings.Builder
+	b.WriteString(ErrValidation.Error())
+	for i, fieldErr := range v {
+		if i == 0 {
+			b.WriteString(": ")
+		} else {
+			b.WriteString("; ")
+		}
+		b.WriteString(fieldErr.Field + ": " + fieldErr.Message)
+	}
+	return b.String()
+}
+
+func (v ValidationErrors) Unwrap() error {
+	return ErrValidation
+}
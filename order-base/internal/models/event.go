@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// order event types
+const (
+	OrderEventCreated = "order.created"
+	OrderEventUpdated = "order.updated"
+)
+
+// OrderEvent is published to Kafka when order is saved or changed
+type OrderEvent struct {
+	Type           string      `json:"type"`
+	OrderUID       string      `json:"order_uid"`
+	Status         OrderStatus `json:"status"`
+	PreviousStatus OrderStatus `json:"previous_status,omitempty"` // only in order.updated
+	Order          *Order      `json:"order,omitempty"`           // only in order.created
+	OccurredAt     time.Time   `json:"occurred_at"`
+}
+
+// OutboxEvent is an OrderEvent stored in the outbox table until it is published
+type OutboxEvent struct {
+	ID       int64
+	Type     string
+	OrderUID string
+	Payload  []byte // OrderEvent json
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// OrderFilter is used to filter listed orders, empty fields are not applied
+type OrderFilter struct {
+	CustomerID      string
+	TrackNumber     string
+	DeliveryService string
+	PaymentProvider string
+	Currency        string
+	CreatedFrom     *time.Time // inclusive
+	CreatedTo       *time.Time // exclusive
+}
+
+// OrderCursor points to the last order of the previous page, orders are listed by date_created DESC and order_uid DESC
+type OrderCursor struct {
+	DateCreated time.Time `json:"date_created"`
+	OrderUID    string    `json:"order_uid"`
+}
+
+type OrdersPage struct {
+	Orders     []Order `json:"orders"`
+	NextCursor string  `json:"next_cursor,omitempty"` // empty if there are no more orders
+}
@@ -7,9 +7,9 @@ type Item struct {
 	Rid         string `json:"rid" db:"rid"`
 	Name        string `json:"name" db:"name"`
 	Sale        int    `json:"sale" db:"sale"`
-	Size        string `json:"size" db:"size"`
+	Size        string `json:"size" db:"size" strict:"optional"`
 	TotalPrice  int    `json:"total_price" db:"total_price"`
 	NmID        int    `json:"nm_id" db:"nm_id"`
-	Brand       string `json:"brand" db:"brand"`
+	Brand       string `json:"brand" db:"brand" strict:"optional"`
 	Status      int    `json:"status" db:"status"`
 }
@@ -3,18 +3,19 @@ package models
 import "time"
 
 type Order struct {
-	OrderUID          string    `json:"order_uid" db:"order_uid"`
-	TrackNumber       string    `json:"track_number" db:"track_number"`
-	Entry             string    `json:"entry" db:"entry"`
-	Delivery          Delivery  `json:"delivery" db:"delivery"`
-	Payment           Payment   `json:"payment" db:"payment"`
-	Items             []Item    `json:"items" db:"items"`
-	Locale            string    `json:"locale" db:"locale"`
-	InternalSignature string    `json:"internal_signature" db:"internal_signature"`
-	CustomerID        string    `json:"customer_id" db:"customer_id"`
-	DeliveryService   string    `json:"delivery_service" db:"delivery_service"`
-	Shardkey          string    `json:"shardkey" db:"shardkey"`
-	SmID              int       `json:"sm_id" db:"sm_id"`
-	DateCreated       time.Time `json:"date_created" db:"date_created"`
-	OofShard          string    `json:"oof_shard" db:"oof_shard"`
+	OrderUID          string      `json:"order_uid" db:"order_uid"`
+	TrackNumber       string      `json:"track_number" db:"track_number"`
+	Entry             string      `json:"entry" db:"entry"`
+	Delivery          Delivery    `json:"delivery" db:"delivery"`
+	Payment           Payment     `json:"payment" db:"payment"`
+	Items             []Item      `json:"items" db:"items"`
+	Locale            string      `json:"locale" db:"locale"`
+	InternalSignature string      `json:"internal_signature" db:"internal_signature" strict:"optional"`
+	CustomerID        string      `json:"customer_id" db:"customer_id"`
+	DeliveryService   string      `json:"delivery_service" db:"delivery_service"`
+	Shardkey          string      `json:"shardkey" db:"shardkey" strict:"optional"`
+	SmID              int         `json:"sm_id" db:"sm_id"`
+	DateCreated       time.Time   `json:"date_created" db:"date_created"`
+	OofShard          string      `json:"oof_shard" db:"oof_shard" strict:"optional"`
+	Status            OrderStatus `json:"status" db:"status" strict:"optional"` // if empty then OrderStatusCreated is set on saving
 }
@@ -2,12 +2,12 @@ package models
 
 type Payment struct {
 	Transaction  string `json:"transaction" db:"transaction"`
-	RequestID    string `json:"request_id" db:"request_id"`
+	RequestID    string `json:"request_id" db:"request_id" strict:"optional"`
 	Currency     string `json:"currency" db:"currency"`
 	Provider     string `json:"provider" db:"provider"`
 	Amount       int    `json:"amount" db:"amount"`
 	PaymentDt    int    `json:"payment_dt" db:"payment_dt"`
-	Bank         string `json:"bank" db:"bank"`
+	Bank         string `json:"bank" db:"bank" strict:"optional"`
 	DeliveryCost int    `json:"delivery_cost" db:"delivery_cost"`
 	GoodsTotal   int    `json:"goods_total" db:"goods_total"`
 	CustomFee    int    `json:"custom_fee" db:"custom_fee"`
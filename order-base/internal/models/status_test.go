@@ -0,0 +1,50 @@
+package models
+
+import "testing"
+
+func TestOrderStatus_CanTransitionTo(t *testing.T) {
+	allowed := map[OrderStatus][]OrderStatus{
+		OrderStatusCreated: {OrderStatusPaid, OrderStatusCancelled},
+		OrderStatusPaid:    {OrderStatusShipped, OrderStatusCancelled},
+		OrderStatusShipped: {OrderStatusDelivered},
+	}
+	statuses := []OrderStatus{OrderStatusCreated, OrderStatusPaid, OrderStatusShipped, OrderStatusDelivered, OrderStatusCancelled, "", "lost"}
+
+	// every pair of statuses is checked, so transitions added to the lifecycle must be added to allowed too
+	for _, from := range statuses {
+		for _, to := range statuses {
+			want := false
+			for _, next := range allowed[from] {
+				if next == to {
+					want = true
+				}
+			}
+
+			if got := from.CanTransitionTo(to); got != want {
+				t.Errorf("%q.CanTransitionTo(%q) = %v, want %v", from, to, got, want)
+			}
+		}
+	}
+}
+
+func TestOrderStatus_IsValid(t *testing.T) {
+	tests := []struct {
+		status OrderStatus
+		want   bool
+	}{
+		{OrderStatusCreated, true},
+		{OrderStatusPaid, true},
+		{OrderStatusShipped, true},
+		{OrderStatusDelivered, true},
+		{OrderStatusCancelled, true},
+		{"", false},
+		{"Created", false},
+		{"lost", false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.status.IsValid(); got != tt.want {
+			t.Errorf("%q.IsValid() = %v, want %v", tt.status, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package redact
+
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Util787/order-base/internal/common"
+)
+
+// Policy defines which fields of json payloads (e.g. kafka message values) are masked in logs
+type Policy struct {
+	paths map[string]string // json path without array indices (e.g. "delivery.email") -> kind
+}
+
+// NewPolicy collects json paths of pii fields of root, payloads in logs are expected to be json of root type
+func NewPolicy(root any) *Policy {
+	p := &Policy{paths: map[string]string{}}
+	p.collect(reflect.TypeOf(root), "", map[reflect.Type]bool{})
+	return p
+}
+
+func (p *Policy) collect(t reflect.Type, path string, visiting map[reflect.Type]bool) {
+	for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || visiting[t] {
+		return
+	}
+	visiting[t] = true
+	defer delete(visiting, t)
+
+	for i := range t.NumField() {
+		field := t.Field(i)
+		name, skip := common.JSONFieldName(field)
+		if skip {
+			continue
+		}
+		fieldPath := joinPath(path, name)
+
+		if kind, ok := field.Tag.Lookup(piiTag); ok && field.Type.Kind() == reflect.String {
+			p.paths[fieldPath] = kind
+			continue
+		}
+		p.collect(field.Type, fieldPath, visiting)
+	}
+}
+
+// Handler masks pii in attributes before passing them to the wrapped handler, so it works with any slog.Handler.
+//
+// Structs are logged the same way as encoding/json would marshal them but with pii fields masked,
+// byte slices are logged as masked json (according to Policy) or as text, binary ones are replaced with their size
+type Handler struct {
+	next   slog.Handler
+	policy *Policy
+}
+
+func NewHandler(next slog.Handler, policy *Policy) *Handler {
+	return &Handler{next: next, policy: policy}
+}
+
+func (h *Handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
+	redacted := slog.NewRecord(r.Time, r.Level, r.Message, r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		redacted.AddAttrs(h.redactAttr(a))
+		return true
+	})
+	return h.next.Handle(ctx, redacted)
+}
+
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		redacted[i] = h.redactAttr(a)
+	}
+	return &Handler{next: h.next.WithAttrs(redacted), policy: h.policy}
+}
+
+func (h *Handler) WithGroup(name string) slog.Handler {
+	return &Handler{next: h.next.WithGroup(name), policy: h.policy}
+}
+
+func (h *Handler) redactAttr(a slog.Attr) slog.Attr {
+	a.Value = a.Value.Resolve()
+
+	switch a.Value.Kind() {
+	case slog.KindGroup:
+		group := a.Value.Group()
+		redacted := make([]slog.Attr, len(group))
+		for i, ga := range group {
+			redacted[i] = h.redactAttr(ga)
+		}
+		return slog.Attr{Key: a.Key, Value: slog.GroupValue(redacted...)}
+	case slog.KindAny:
+		return slog.Any(a.Key, h.logValue(reflect.ValueOf(a.Value.Any()), "", 0))
+	}
+	return a
+}
+
+// deeper values are not logged, it prevents endless recursion on cyclic values
+const maxLogDepth = 16
+
+var (
+	jsonMarshalerType = reflect.TypeFor[json.Marshaler]()
+	textMarshalerType = reflect.TypeFor[encoding.TextMarshaler]()
+	errorType         = reflect.TypeFor[error]()
+)
+
+// logValue converts v to a value that is logged without pii, kind is the pii tag of the field v is taken from
+func (h *Handler) logValue(v reflect.Value, kind string, depth int) any {
+	if !v.IsValid() {
+		return nil
+	}
+	if depth > maxLogDepth {
+		return "..."
+	}
+
+	t := v.Type()
+	if t.Implements(errorType) || t.Implements(jsonMarshalerType) || t.Implements(textMarshalerType) {
+		if t.Kind() == reflect.String && kind != "" {
+			return MaskString(kind, v.String())
+		}
+		return v.Interface()
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return h.logValue(v.Elem(), kind, depth+1)
+
+	case reflect.Struct:
+		fields := make(map[string]any, t.NumField())
+		for i := range t.NumField() {
+			field := t.Field(i)
+			name, skip := common.JSONFieldName(field)
+			if skip {
+				continue
+			}
+			fields[name] = h.logValue(v.Field(i), field.Tag.Get(piiTag), depth+1)
+		}
+		return fields
+
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil
+		}
+		if t.Elem().Kind() == reflect.Uint8 {
+			return h.payload(v.Bytes())
+		}
+		fallthrough
+	case reflect.Array:
+		elems := make([]any, v.Len())
+		for i := range v.Len() {
+			elems[i] = h.logValue(v.Index(i), kind, depth+1)
+		}
+		return elems
+
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		entries := make(map[string]any, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			entries[fmt.Sprint(iter.Key().Interface())] = h.logValue(iter.Value(), kind, depth+1)
+		}
+		return entries
+
+	case reflect.String:
+		if kind != "" {
+			return MaskString(kind, v.String())
+		}
+		return v.String()
+
+	case reflect.Func, reflect.Chan, reflect.UnsafePointer:
+		return nil // they cant be marshaled by json handler
+	}
+
+	return v.Interface()
+}
+
+// payload returns json with pii fields masked, text as string or only the size of binary data (e.g. protobuf or avro that may contain pii)
+func (h *Handler) payload(data []byte) any {
+	var decoded any
+	if err := json.Unmarshal(data, &decoded); err == nil {
+		return h.policy.maskJSON(decoded, "")
+	}
+	if isText(data) {
+		return string(data)
+	}
+	return fmt.Sprintf("<%d bytes>", len(data))
+}
+
+func (p *Policy) maskJSON(value any, path string) any {
+	switch value := value.(type) {
+	case map[string]any:
+		for key, field := range value {
+			fieldPath := joinPath(path, key)
+			if s, ok := field.(string); ok {
+				if kind, found := p.paths[fieldPath]; found {
+					value[key] = MaskString(kind, s)
+				}
+				continue
+			}
+			value[key] = p.maskJSON(field, fieldPath)
+		}
+	case []any:
+		for i, elem := range value {
+			value[i] = p.maskJSON(elem, path)
+		}
+	}
+	return value
+}
+
+func isText(data []byte) bool {
+	if !utf8.Valid(data) {
+		return false
+	}
+	return strings.IndexFunc(string(data), func(r rune) bool {
+		return !unicode.IsPrint(r) && !unicode.IsSpace(r)
+	}) == -1
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
@@ -0,0 +1,111 @@
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"reflect"
+	"testing"
+)
+
+type testMessage struct {
+	Customer testCustomer  `json:"customer"`
+	Contacts []testContact `json:"contacts"`
+}
+
+// logAttr logs value as attribute "value" through Handler and returns it as decoded from json log line
+func logAttr(t *testing.T, attr slog.Attr) any {
+	t.Helper()
+
+	var buf bytes.Buffer
+	log := slog.New(NewHandler(slog.NewJSONHandler(&buf, nil), NewPolicy(testMessage{})))
+	log.Info("test", attr)
+
+	var line map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("failed to decode log line %q: %v", buf.String(), err)
+	}
+	return line[attr.Key]
+}
+
+func TestHandler_Payload(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    any
+	}{
+		{
+			name:    "json",
+			payload: `{"customer":{"id":"c1","contact":{"name":"Test","email":"test@gmail.com","phone":"+9720000042","city":"Moscow"}},"contacts":[{"name":"Other","phone":"+9720000043"}]}`,
+			want: map[string]any{
+				"customer": map[string]any{"id": "c1", "contact": map[string]any{"name": "T***", "email": "t***@gmail.com", "phone": "***42", "city": "Moscow"}},
+				"contacts": []any{map[string]any{"name": "O***", "phone": "***43"}},
+			},
+		},
+		{
+			// only paths of the policy root are masked
+			name:    "json of other type",
+			payload: `{"name":"Test","contact":{"name":"Test"}}`,
+			want:    map[string]any{"name": "Test", "contact": map[string]any{"name": "Test"}},
+		},
+		{
+			name:    "non-string pii values are kept",
+			payload: `{"customer":{"contact":{"name":42,"email":null}}}`,
+			want:    map[string]any{"customer": map[string]any{"contact": map[string]any{"name": float64(42), "email": nil}}},
+		},
+		{"text", "not json", "not json"},
+		{"binary", "\x0a\x02\xff\xfe", "<4 bytes>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := logAttr(t, slog.Any("value", []byte(tt.payload)))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("logged payload = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandler_Struct(t *testing.T) {
+	contact := testContact{Name: "Test", Email: "test@gmail.com", Phone: "+9720000042", City: "Moscow"}
+
+	got := logAttr(t, slog.Any("value", &testMessage{Customer: testCustomer{ID: "c1", Contact: contact}, Contacts: []testContact{contact}}))
+
+	maskedContact := map[string]any{"name": "T***", "email": "t***@gmail.com", "phone": "***42", "city": "Moscow"}
+	customer := got.(map[string]any)["customer"].(map[string]any)
+	if !reflect.DeepEqual(customer["contact"], maskedContact) {
+		t.Errorf("logged contact = %#v, want %#v", customer["contact"], maskedContact)
+	}
+	if contacts := got.(map[string]any)["contacts"]; !reflect.DeepEqual(contacts, []any{maskedContact}) {
+		t.Errorf("logged contacts = %#v, want %#v", contacts, []any{maskedContact})
+	}
+	if _, found := customer["private"]; found {
+		t.Error("unexported field is logged")
+	}
+}
+
+func TestHandler_GroupsAndWithAttrs(t *testing.T) {
+	var buf bytes.Buffer
+	log := slog.New(NewHandler(slog.NewJSONHandler(&buf, nil), NewPolicy(testMessage{})))
+
+	payload := []byte(`{"customer":{"contact":{"email":"test@gmail.com"}}}`)
+	log.With(slog.Any("with", payload)).Info("test", slog.Group("group", slog.Any("payload", payload)), slog.Any("error", errors.New("failed")))
+
+	var line map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("failed to decode log line %q: %v", buf.String(), err)
+	}
+
+	want := map[string]any{"customer": map[string]any{"contact": map[string]any{"email": "t***@gmail.com"}}}
+	if !reflect.DeepEqual(line["with"], want) {
+		t.Errorf("logged attribute of With = %#v, want %#v", line["with"], want)
+	}
+	if got := line["group"].(map[string]any)["payload"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("logged attribute of group = %#v, want %#v", got, want)
+	}
+	if line["error"] != "failed" {
+		t.Errorf("logged error = %#v, want %q", line["error"], "failed")
+	}
+}
@@ -0,0 +1,152 @@
+// Package redact masks personal data, fields are marked with `pii:"<kind>"` struct tag.
+//
+// Kinds KindEmail and KindPhone keep parts useful for support (domain, last digits), any other kind keeps only the first character
+package redact
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+const piiTag = "pii"
+
+const (
+	KindEmail = "email"
+	KindPhone = "phone"
+)
+
+const maskSuffix = "***"
+
+// MaskString masks s according to kind, empty strings are kept empty
+func MaskString(kind, s string) string {
+	if s == "" {
+		return ""
+	}
+
+	switch kind {
+	case KindEmail:
+		local, domain, found := strings.Cut(s, "@")
+		if found {
+			return firstRune(local) + maskSuffix + "@" + domain
+		}
+	case KindPhone:
+		// short numbers would be revealed almost completely
+		if len(s) > 4 {
+			return maskSuffix + s[len(s)-2:]
+		}
+		return maskSuffix
+	}
+
+	return firstRune(s) + maskSuffix
+}
+
+func firstRune(s string) string {
+	_, size := utf8.DecodeRuneInString(s)
+	return s[:size]
+}
+
+// Mask returns copy of v with pii fields masked, v itself (including its slices and pointers) is not modified
+func Mask[T any](v T) T {
+	rv := reflect.ValueOf(&v).Elem()
+	if hasPII(rv.Type()) {
+		maskValue(rv)
+	}
+	return v
+}
+
+// maskValue masks addressable v in place, slices and pointers are copied before masking
+func maskValue(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		for i := range t.NumField() {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			if kind, ok := field.Tag.Lookup(piiTag); ok && field.Type.Kind() == reflect.String {
+				v.Field(i).SetString(MaskString(kind, v.Field(i).String()))
+				continue
+			}
+			if hasPII(field.Type) {
+				maskValue(v.Field(i))
+			}
+		}
+
+	case reflect.Slice:
+		if v.IsNil() {
+			return
+		}
+		copied := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		reflect.Copy(copied, v)
+		v.Set(copied)
+		for i := range copied.Len() {
+			maskValue(copied.Index(i))
+		}
+
+	case reflect.Array:
+		for i := range v.Len() {
+			maskValue(v.Index(i))
+		}
+
+	case reflect.Pointer:
+		if v.IsNil() {
+			return
+		}
+		copied := reflect.New(v.Type().Elem())
+		copied.Elem().Set(v.Elem())
+		v.Set(copied)
+		maskValue(copied.Elem())
+	}
+}
+
+var (
+	piiTypes   = map[reflect.Type]bool{}
+	piiTypesMu sync.RWMutex
+)
+
+// hasPII reports whether values of t may contain pii fields
+func hasPII(t reflect.Type) bool {
+	piiTypesMu.RLock()
+	result, ok := piiTypes[t]
+	piiTypesMu.RUnlock()
+	if ok {
+		return result
+	}
+
+	result = checkPII(t, map[reflect.Type]bool{})
+
+	piiTypesMu.Lock()
+	piiTypes[t] = result
+	piiTypesMu.Unlock()
+	return result
+}
+
+// checkPII doesnt use cache, visiting prevents endless recursion on recursive types
+func checkPII(t reflect.Type, visiting map[reflect.Type]bool) bool {
+	if visiting[t] {
+		return false // the type is already being checked up the stack
+	}
+	visiting[t] = true
+
+	switch t.Kind() {
+	case reflect.Struct:
+		for i := range t.NumField() {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			if _, ok := field.Tag.Lookup(piiTag); ok && field.Type.Kind() == reflect.String {
+				return true
+			}
+			if checkPII(field.Type, visiting) {
+				return true
+			}
+		}
+	case reflect.Slice, reflect.Array, reflect.Pointer:
+		return checkPII(t.Elem(), visiting)
+	}
+	return false
+}
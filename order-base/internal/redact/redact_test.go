@@ -0,0 +1,105 @@
+package redact
+
+import (
+	"reflect"
+	"testing"
+)
+
+type testContact struct {
+	Name  string `json:"name" pii:"name"`
+	Email string `json:"email" pii:"email"`
+	Phone string `json:"phone" pii:"phone"`
+	City  string `json:"city"`
+}
+
+type testCustomer struct {
+	ID       string         `json:"id"`
+	Contact  testContact    `json:"contact"`
+	Previous *testContact   `json:"previous"`
+	Others   []testContact  `json:"others"`
+	Pair     [2]testContact `json:"pair"`
+	Nickname string         `json:"nickname" pii:""`
+	private  string         `pii:"name"`
+}
+
+func TestMaskString(t *testing.T) {
+	tests := []struct {
+		kind string
+		s    string
+		want string
+	}{
+		{KindEmail, "test@gmail.com", "t***@gmail.com"},
+		{KindEmail, "тест@mail.ru", "т***@mail.ru"},
+		{KindEmail, "not-an-email", "n***"},
+		{KindPhone, "+9720000042", "***42"},
+		{KindPhone, "+972", "***"},
+		{"name", "Test Testov", "T***"},
+		{"name", "Тест", "Т***"},
+		{"name", "", ""},
+	}
+
+	for _, tt := range tests {
+		if got := MaskString(tt.kind, tt.s); got != tt.want {
+			t.Errorf("MaskString(%q, %q) = %q, want %q", tt.kind, tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestMask(t *testing.T) {
+	contact := func(name string) testContact {
+		return testContact{Name: name, Email: name + "@gmail.com", Phone: "+9720000042", City: "Moscow"}
+	}
+	masked := func(name string) testContact {
+		return testContact{Name: name[:1] + "***", Email: name[:1] + "***@gmail.com", Phone: "***42", City: "Moscow"}
+	}
+
+	previous := contact("previous")
+	customer := testCustomer{
+		ID:       "customer",
+		Contact:  contact("current"),
+		Previous: &previous,
+		Others:   []testContact{contact("other")},
+		Pair:     [2]testContact{contact("first"), contact("second")},
+		Nickname: "nick",
+		private:  "private",
+	}
+	original := customer
+	original.Others = []testContact{contact("other")}
+	originalPrevious := previous
+
+	got := Mask(customer)
+
+	maskedPrevious := masked("previous")
+	want := testCustomer{
+		ID:       "customer",
+		Contact:  masked("current"),
+		Previous: &maskedPrevious,
+		Others:   []testContact{masked("other")},
+		Pair:     [2]testContact{masked("first"), masked("second")},
+		Nickname: "n***",
+		private:  "private", // unexported fields are not masked
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Mask() = %+v, want %+v", got, want)
+	}
+
+	// slices and pointers are copied before masking
+	if !reflect.DeepEqual(customer.Others, original.Others) || *customer.Previous != originalPrevious {
+		t.Errorf("Mask() modified its argument: %+v", customer)
+	}
+}
+
+func TestMask_WithoutPII(t *testing.T) {
+	type noPII struct {
+		Values []string
+	}
+	v := noPII{Values: []string{"a"}}
+
+	got := Mask(v)
+	if &got.Values[0] != &v.Values[0] {
+		t.Error("Mask() copied value without pii fields")
+	}
+	if got := Mask("text"); got != "text" {
+		t.Errorf("Mask() = %q, want text", got)
+	}
+}
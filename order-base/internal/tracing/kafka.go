@@ -0,0 +1,55 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ExtractFromKafkaHeaders returns span context propagated by the producer, it is invalid if headers have no trace context
+func ExtractFromKafkaHeaders(headers []kafka.Header) trace.SpanContext {
+	ctx := otel.GetTextMapPropagator().Extract(context.Background(), kafkaHeaderCarrier{headers: &headers})
+	return trace.SpanContextFromContext(ctx)
+}
+
+// InjectIntoKafkaHeaders appends trace context of ctx to headers
+func InjectIntoKafkaHeaders(ctx context.Context, headers []kafka.Header) []kafka.Header {
+	otel.GetTextMapPropagator().Inject(ctx, kafkaHeaderCarrier{headers: &headers})
+	return headers
+}
+
+type kafkaHeaderCarrier struct {
+	headers *[]kafka.Header
+}
+
+var _ propagation.TextMapCarrier = kafkaHeaderCarrier{}
+
+func (c kafkaHeaderCarrier) Get(key string) string {
+	for _, h := range *c.headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func (c kafkaHeaderCarrier) Set(key, value string) {
+	for i, h := range *c.headers {
+		if h.Key == key {
+			(*c.headers)[i].Value = []byte(value)
+			return
+		}
+	}
+	*c.headers = append(*c.headers, kafka.Header{Key: key, Value: []byte(value)})
+}
+
+func (c kafkaHeaderCarrier) Keys() []string {
+	keys := make([]string, 0, len(*c.headers))
+	for _, h := range *c.headers {
+		keys = append(keys, h.Key)
+	}
+	return keys
+}
@@ -0,0 +1,36 @@
+package usecase
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+
+	"github.com/Util787/order-base/internal/models"
+)
+
+// cursors are opaque for clients so the listing order can be changed without breaking them
+
+func encodeCursor(cursor models.OrderCursor) (string, error) {
+	b, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func decodeCursor(s string) (models.OrderCursor, error) {
+	var cursor models.OrderCursor
+
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor, err
+	}
+	if err := json.Unmarshal(b, &cursor); err != nil {
+		return cursor, err
+	}
+	// any json object is decoded, e.g. "{}" would point before all orders and return an empty page
+	if cursor.DateCreated.IsZero() || cursor.OrderUID == "" {
+		return cursor, errors.New("cursor is incomplete")
+	}
+	return cursor, nil
+}
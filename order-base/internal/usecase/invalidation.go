@@ -0,0 +1,37 @@
+package usecase
+
+import (
+	"hash/maphash"
+	"sync/atomic"
+)
+
+// ids are spread over a fixed number of counters so memory doesnt grow with the number of orders,
+// ids sharing a counter only cause some extra skipped cache writes
+const invalidationStripes = 1024
+
+// invalidations counts invalidations of cached orders. Order read from the order storage before its invalidation
+// may have the previous status, so it is cached only if the generation of its id didnt change since the read started.
+//
+// Generations are kept only in this instance, invalidations made by other replicas are not seen
+type invalidations struct {
+	seed        maphash.Seed
+	generations [invalidationStripes]atomic.Uint64
+}
+
+func newInvalidations() *invalidations {
+	return &invalidations{seed: maphash.MakeSeed()}
+}
+
+// generation must be taken before the order is read from the order storage
+func (i *invalidations) generation(id string) uint64 {
+	return i.stripe(id).Load()
+}
+
+// invalidate must be called before the cached order is deleted
+func (i *invalidations) invalidate(id string) {
+	i.stripe(id).Add(1)
+}
+
+func (i *invalidations) stripe(id string) *atomic.Uint64 {
+	return &i.generations[maphash.String(i.seed, id)%invalidationStripes]
+}
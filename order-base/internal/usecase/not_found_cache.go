@@ -0,0 +1,65 @@
+package usecase
+
+import (
+	"sync"
+	"time"
+)
+
+// notFoundCache is bounded so enumeration of random ids cant grow it without limit
+const notFoundCacheMaxEntries = 10000
+
+// notFoundCache remembers ids of orders that were not found in the order storage
+type notFoundCache struct {
+	mu          sync.Mutex
+	ttl         time.Duration
+	expirations map[string]time.Time
+}
+
+func newNotFoundCache(ttl time.Duration) *notFoundCache {
+	return &notFoundCache{
+		ttl:         ttl,
+		expirations: make(map[string]time.Time),
+	}
+}
+
+func (c *notFoundCache) has(id string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expiration, found := c.expirations[id]
+	if !found {
+		return false
+	}
+	if time.Now().After(expiration) {
+		delete(c.expirations, id)
+		return false
+	}
+	return true
+}
+
+// add skips id if cache is full even after removing expired ids
+func (c *notFoundCache) add(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if len(c.expirations) >= notFoundCacheMaxEntries {
+		for key, expiration := range c.expirations {
+			if now.After(expiration) {
+				delete(c.expirations, key)
+			}
+		}
+		if len(c.expirations) >= notFoundCacheMaxEntries {
+			return
+		}
+	}
+
+	c.expirations[id] = now.Add(c.ttl)
+}
+
+func (c *notFoundCache) forget(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.expirations, id)
+}
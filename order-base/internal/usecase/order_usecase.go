@@ -2,58 +2,300 @@ package usecase
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
+	"time"
 	"unicode/utf8"
 
 	"github.com/Util787/order-base/internal/common"
 	"github.com/Util787/order-base/internal/models"
+	"github.com/Util787/order-base/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var tracer = tracing.Tracer("github.com/Util787/order-base/internal/usecase")
+
 func (u *OrderUsecase) GetOrderById(ctx context.Context, id string) (models.Order, error) {
 	op := common.GetOperationName()
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
 	log := common.LogOpAndId(ctx, op, u.log)
 
 	// validation
 	if err := validateOrderID(id); err != nil {
-		return models.Order{}, fmt.Errorf("%s: %w", op, err)
+		return models.Order{}, tracing.RecordError(span, fmt.Errorf("%s: %w", op, err))
 	}
 
-	order, err := u.cacheStorage.GetOrder(ctx, id)
+	order, err := u.getCachedOrder(ctx, id)
 	if err == nil {
 		log.Debug("found in cache", slog.String("order_id", id))
 		return order, nil
 	}
 	log.Debug("failed to found in cache, fetching from storage", slog.String("order_id", id), slog.String("error", err.Error()))
 
-	order, err = u.orderStorage.GetOrderById(ctx, id)
+	if u.notFound != nil && u.notFound.has(id) {
+		span.SetAttributes(attribute.Bool("cache.negative_hit", true))
+		return models.Order{}, tracing.RecordError(span, fmt.Errorf("%s: %w", op, models.ErrOrdersNotFound))
+	}
+
+	if u.staleCache != nil {
+		if order, err := u.staleCache.GetStaleOrder(ctx, id); err == nil {
+			log.Debug("serving stale order, refreshing it in background", slog.String("order_id", id))
+			span.SetAttributes(attribute.Bool("cache.stale", true))
+			u.fetchGroup.DoChan(id, u.fetchOrderFunc(ctx, id))
+			return order, nil
+		}
+	}
+
+	order, err = u.fetchOrder(ctx, id)
 	if err != nil {
-		return models.Order{}, fmt.Errorf("%s: %w", op, err)
+		return models.Order{}, tracing.RecordError(span, fmt.Errorf("%s: %w", op, err))
 	}
-	if err = u.cacheStorage.CacheOrder(ctx, order.OrderUID, order, &common.DefaultTTL); err != nil {
-		log.Warn("failed to cache order", slog.String("order_id", order.OrderUID), slog.String("error", err.Error()))
+
+	return order, nil
+}
+
+// fetchTimeout limits fetches that are not canceled together with the request that started them
+const fetchTimeout = 5 * time.Second
+
+// fetchOrder gets order from the order storage and caches it, concurrent fetches of the same id are coalesced into one storage call.
+//
+// Caller stops waiting when ctx is done but the fetch itself continues for other callers
+func (u *OrderUsecase) fetchOrder(ctx context.Context, id string) (models.Order, error) {
+	select {
+	case <-ctx.Done():
+		return models.Order{}, ctx.Err()
+	case res := <-u.fetchGroup.DoChan(id, u.fetchOrderFunc(ctx, id)):
+		trace.SpanFromContext(ctx).SetAttributes(attribute.Bool("fetch.shared", res.Shared))
+		if res.Err != nil {
+			return models.Order{}, res.Err
+		}
+		return res.Val.(models.Order), nil
 	}
+}
+
+func (u *OrderUsecase) fetchOrderFunc(ctx context.Context, id string) func() (any, error) {
+	return func() (any, error) {
+		// fetch is shared with other callers, so it must not be canceled by the caller that started it
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), fetchTimeout)
+		defer cancel()
+		log := common.LogOpAndId(ctx, common.GetOperationName(), u.log)
+
+		generation := u.invalidations.generation(id)
+		order, err := u.orderStorage.GetOrderById(ctx, id)
+		if err != nil {
+			if u.notFound != nil && errors.Is(err, models.ErrOrdersNotFound) {
+				u.notFound.add(id)
+			}
+			return models.Order{}, err
+		}
+
+		u.cacheStoredOrder(ctx, log, order, generation)
+		return order, nil
+	}
+}
+
+// SaveOrder returns the stored order and whether it was created, order that already exists is returned as it is stored
+func (u *OrderUsecase) SaveOrder(ctx context.Context, order models.Order) (models.Order, bool, error) {
+	op := common.GetOperationName()
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+	log := common.LogOpAndId(ctx, op, u.log)
 
+	if order.Status == "" {
+		order.Status = models.OrderStatusCreated
+	}
+
+	// validation
+	if err := validateOrder(order); err != nil {
+		return models.Order{}, false, tracing.RecordError(span, fmt.Errorf("%s: %w", op, err))
+	}
+
+	// redelivered order is cached as it is stored, its status may be already changed
+	generation := u.invalidations.generation(order.OrderUID)
+	stored, created, err := u.orderStorage.SaveOrder(ctx, order)
+	if err != nil {
+		return models.Order{}, false, tracing.RecordError(span, fmt.Errorf("%s: %w", op, err))
+	}
+	u.forgetNotFound(stored.OrderUID)
+	u.cacheStoredOrder(ctx, log, stored, generation)
+
+	return stored, created, nil
+}
+
+// SaveOrders validates and saves all orders at once, if any order is invalid or fails to be saved then none of them are saved
+func (u *OrderUsecase) SaveOrders(ctx context.Context, orders []models.Order) error {
+	op := common.GetOperationName()
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+	span.SetAttributes(attribute.Int("orders.count", len(orders)))
+	log := common.LogOpAndId(ctx, op, u.log)
+
+	// default status is set on the copy, so orders of the caller are not changed
+	orders = slices.Clone(orders)
+	for i := range orders {
+		if orders[i].Status == "" {
+			orders[i].Status = models.OrderStatusCreated
+		}
+
+		// validation
+		if err := validateOrder(orders[i]); err != nil {
+			return tracing.RecordError(span, fmt.Errorf("%s: order %s: %w", op, orders[i].OrderUID, err))
+		}
+	}
+
+	// bulk saving fails if any order already exists (callers fall back to SaveOrder), so all orders are new and can be cached as they are
+	// unless their status is changed right after they are saved
+	generations := make([]uint64, len(orders))
+	for i, order := range orders {
+		generations[i] = u.invalidations.generation(order.OrderUID)
+	}
+	if err := u.orderStorage.SaveOrders(ctx, orders); err != nil {
+		return tracing.RecordError(span, fmt.Errorf("%s: %w", op, err))
+	}
+	for i, order := range orders {
+		u.forgetNotFound(order.OrderUID)
+		u.cacheStoredOrder(ctx, log, order, generations[i])
+	}
+
+	return nil
+}
+
+// ChangeOrderStatus moves order to status according to the order lifecycle and returns the updated order.
+//
+// Order is taken from the order storage and not from cache so transition is checked against the actual status
+func (u *OrderUsecase) ChangeOrderStatus(ctx context.Context, id string, status models.OrderStatus) (models.Order, error) {
+	op := common.GetOperationName()
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+	log := common.LogOpAndId(ctx, op, u.log)
+
+	// validation
+	if err := validateOrderID(id); err != nil {
+		return models.Order{}, tracing.RecordError(span, fmt.Errorf("%s: %w", op, err))
+	}
+	if !status.IsValid() {
+		return models.Order{}, tracing.RecordError(span, fmt.Errorf("%s: %w: %q", op, models.ErrInvalidOrderStatus, status))
+	}
+
+	order, err := u.orderStorage.GetOrderById(ctx, id)
+	if err != nil {
+		return models.Order{}, tracing.RecordError(span, fmt.Errorf("%s: %w", op, err))
+	}
+
+	if !order.Status.CanTransitionTo(status) {
+		return models.Order{}, tracing.RecordError(span, fmt.Errorf("%s: %w: from %s to %s", op, models.ErrInvalidStatusTransition, order.Status, status))
+	}
+
+	if err := u.orderStorage.UpdateOrderStatus(ctx, id, order.Status, status); err != nil {
+		return models.Order{}, tracing.RecordError(span, fmt.Errorf("%s: %w", op, err))
+	}
+	log.Info("order status changed", slog.String("order_id", id), slog.String("from", string(order.Status)), slog.String("to", string(status)))
+
+	// cached order has the previous status, fetches started before the update must neither cache it again nor be joined by new callers
+	u.invalidations.invalidate(id)
+	u.fetchGroup.Forget(id)
+	if err := u.cacheStorage.DeleteOrder(ctx, id); err != nil {
+		log.Warn("failed to invalidate cached order", slog.String("order_id", id), slog.String("error", err.Error()))
+	}
+
+	order.Status = status
 	return order, nil
 }
 
-func (u *OrderUsecase) SaveOrder(ctx context.Context, order models.Order) error {
+// CancelOrder is a shortcut for ChangeOrderStatus with models.OrderStatusCancelled
+func (u *OrderUsecase) CancelOrder(ctx context.Context, id string) (models.Order, error) {
+	return u.ChangeOrderStatus(ctx, id, models.OrderStatusCancelled)
+}
+
+// ListOrders returns a page of orders matching filter, cursor is taken from the previous page and should be empty for the first one.
+//
+// if limit is 0 then common.DefaultOrdersPageSize is used
+func (u *OrderUsecase) ListOrders(ctx context.Context, filter models.OrderFilter, cursor string, limit uint64) (models.OrdersPage, error) {
 	op := common.GetOperationName()
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
 	log := common.LogOpAndId(ctx, op, u.log)
 
 	// validation
-	if err := validateOrderID(order.OrderUID); err != nil {
-		return fmt.Errorf("%s: %w", op, err)
+	v := validator{}
+	if limit == 0 {
+		limit = common.DefaultOrdersPageSize
+	}
+	v.check(limit <= common.MaxOrdersPageSize, "limit", fmt.Sprintf("must be at most %d", common.MaxOrdersPageSize))
+	if filter.CreatedFrom != nil && filter.CreatedTo != nil {
+		v.check(filter.CreatedFrom.Before(*filter.CreatedTo), "created_from", "must be before created_to")
+	}
+
+	var orderCursor *models.OrderCursor
+	if cursor != "" {
+		decoded, err := decodeCursor(cursor)
+		v.check(err == nil, "cursor", "is invalid")
+		orderCursor = &decoded
+	}
+	if err := v.err(); err != nil {
+		return models.OrdersPage{}, tracing.RecordError(span, fmt.Errorf("%s: %w", op, err))
 	}
 
-	if err := u.orderStorage.SaveOrder(ctx, order); err != nil {
-		return fmt.Errorf("%s: %w", op, err)
+	// one extra order is fetched to know if there is a next page
+	orders, err := u.orderStorage.ListOrders(ctx, filter, orderCursor, limit+1)
+	if err != nil {
+		return models.OrdersPage{}, tracing.RecordError(span, fmt.Errorf("%s: %w", op, err))
 	}
-	if err := u.cacheStorage.CacheOrder(ctx, order.OrderUID, order, &common.DefaultTTL); err != nil {
+
+	page := models.OrdersPage{Orders: orders}
+	if uint64(len(orders)) > limit {
+		page.Orders = orders[:limit]
+		last := page.Orders[limit-1]
+		page.NextCursor, err = encodeCursor(models.OrderCursor{DateCreated: last.DateCreated, OrderUID: last.OrderUID})
+		if err != nil {
+			return models.OrdersPage{}, tracing.RecordError(span, fmt.Errorf("%s: failed to encode cursor: %w", op, err))
+		}
+	}
+	log.Debug("orders listed", slog.Int("count", len(page.Orders)))
+
+	return page, nil
+}
+
+// getCachedOrder is separated to trace cache lookups regardless of the cache backend
+func (u *OrderUsecase) getCachedOrder(ctx context.Context, id string) (models.Order, error) {
+	ctx, span := tracer.Start(ctx, "cache.GetOrder")
+	defer span.End()
+
+	order, err := u.cacheStorage.GetOrder(ctx, id)
+	span.SetAttributes(attribute.Bool("cache.hit", err == nil))
+	return order, err
+}
+
+// cacheStoredOrder caches order read from or written to the order storage, generation must be taken before that,
+// order is not cached if it was invalidated meanwhile
+func (u *OrderUsecase) cacheStoredOrder(ctx context.Context, log *slog.Logger, order models.Order, generation uint64) {
+	if u.invalidations.generation(order.OrderUID) != generation {
+		log.Debug("order was invalidated while it was read, it is not cached", slog.String("order_id", order.OrderUID))
+		return
+	}
+
+	if err := u.cacheStorage.CacheOrder(ctx, order.OrderUID, order, &u.cacheTTL); err != nil {
 		log.Warn("failed to cache order", slog.String("order_id", order.OrderUID), slog.String("error", err.Error()))
+		return
 	}
 
-	return nil
+	// invalidation between the check and CacheOrder could delete the order before it was cached
+	if u.invalidations.generation(order.OrderUID) != generation {
+		if err := u.cacheStorage.DeleteOrder(ctx, order.OrderUID); err != nil {
+			log.Warn("failed to invalidate cached order", slog.String("order_id", order.OrderUID), slog.String("error", err.Error()))
+		}
+	}
+}
+
+// forgetNotFound should be called after order is saved, so it is not reported as not found anymore
+func (u *OrderUsecase) forgetNotFound(id string) {
+	if u.notFound != nil {
+		u.notFound.forget(id)
+	}
 }
 
 func validateOrderID(id string) error {
@@ -0,0 +1,263 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Util787/order-base/internal/models"
+)
+
+// testOrder returns a valid new order with unique uids
+func testOrder(i int) models.Order {
+	uid := fmt.Sprintf("b563feb7b2b84b6test%013d", i)
+	return models.Order{
+		OrderUID:    uid,
+		TrackNumber: "WBILMTESTTRACK",
+		Entry:       "WBIL",
+		Delivery: models.Delivery{
+			DeliveryUID: "delivery-" + uid,
+			Name:        "Test Testov",
+			Phone:       "+9720000000",
+			Zip:         "2639809",
+			City:        "Kiryat Mozkin",
+			Address:     "Ploshad Mira 15",
+			Region:      "Kraiot",
+			Email:       "test@gmail.com",
+		},
+		Payment: models.Payment{Transaction: uid, Currency: "USD", Provider: "wbpay", Amount: 1817, GoodsTotal: 317, DeliveryCost: 1500},
+		Items: []models.Item{
+			{ChrtID: 9934930, TrackNumber: "WBILMTESTTRACK", Price: 453, Rid: "ab4219087a764ae0btest", Name: "Mascaras", TotalPrice: 317, NmID: 2389212, Brand: "Vivienne Sabo", Status: 202},
+		},
+		Locale:          "en",
+		CustomerID:      "test",
+		DeliveryService: "meest",
+		DateCreated:     time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC),
+		Status:          models.OrderStatusCreated,
+	}
+}
+
+// fakeOrderStorage keeps orders in a map, UpdateOrderStatus checks the current status the same way as the postgres storage
+type fakeOrderStorage struct {
+	mu     sync.Mutex
+	orders map[string]models.Order
+
+	// beforeUpdate is called by UpdateOrderStatus before the status is checked, may be nil
+	beforeUpdate func()
+}
+
+func newFakeOrderStorage(orders ...models.Order) *fakeOrderStorage {
+	s := &fakeOrderStorage{orders: make(map[string]models.Order)}
+	for _, order := range orders {
+		s.orders[order.OrderUID] = order
+	}
+	return s
+}
+
+func (s *fakeOrderStorage) GetOrderById(ctx context.Context, id string) (models.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	order, ok := s.orders[id]
+	if !ok {
+		return models.Order{}, models.ErrOrdersNotFound
+	}
+	return order, nil
+}
+
+func (s *fakeOrderStorage) SaveOrder(ctx context.Context, order models.Order) (models.Order, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing, ok := s.orders[order.OrderUID]; ok {
+		return existing, false, nil
+	}
+	s.orders[order.OrderUID] = order
+	return order, true, nil
+}
+
+func (s *fakeOrderStorage) SaveOrders(ctx context.Context, orders []models.Order) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, order := range orders {
+		s.orders[order.OrderUID] = order
+	}
+	return nil
+}
+
+func (s *fakeOrderStorage) ListOrders(ctx context.Context, filter models.OrderFilter, cursor *models.OrderCursor, limit uint64) ([]models.Order, error) {
+	return nil, nil
+}
+
+func (s *fakeOrderStorage) UpdateOrderStatus(ctx context.Context, id string, from, to models.OrderStatus) error {
+	if s.beforeUpdate != nil {
+		s.beforeUpdate()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	order, ok := s.orders[id]
+	if !ok {
+		return models.ErrOrdersNotFound
+	}
+	if order.Status != from {
+		return models.ErrConcurrentStatusChange
+	}
+	order.Status = to
+	s.orders[id] = order
+	return nil
+}
+
+// fakeCacheStorage keeps orders in a map without expiration
+type fakeCacheStorage struct {
+	mu     sync.Mutex
+	orders map[string]models.Order
+}
+
+func newFakeCacheStorage() *fakeCacheStorage {
+	return &fakeCacheStorage{orders: make(map[string]models.Order)}
+}
+
+func (c *fakeCacheStorage) GetOrder(ctx context.Context, key string) (models.Order, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	order, ok := c.orders[key]
+	if !ok {
+		return models.Order{}, models.ErrOrdersNotFound
+	}
+	return order, nil
+}
+
+func (c *fakeCacheStorage) CacheOrder(ctx context.Context, key string, order models.Order, ttl *time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.orders[key] = order
+	return nil
+}
+
+func (c *fakeCacheStorage) DeleteOrder(ctx context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.orders, key)
+	return nil
+}
+
+func newTestUsecase(orderStorage OrderStorage, cacheStorage CacheStorage) OrderUsecase {
+	return NewOrderUsecase(slog.New(slog.NewTextHandler(io.Discard, nil)), orderStorage, cacheStorage, time.Minute)
+}
+
+func TestOrderUsecase_SaveOrdersDoesntChangeInput(t *testing.T) {
+	orderStorage := newFakeOrderStorage()
+	u := newTestUsecase(orderStorage, newFakeCacheStorage())
+
+	orders := []models.Order{testOrder(1), testOrder(2)}
+	for i := range orders {
+		orders[i].Status = ""
+	}
+	want := []models.Order{orders[0], orders[1]}
+
+	if err := u.SaveOrders(context.Background(), orders); err != nil {
+		t.Fatalf("SaveOrders() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(orders, want) {
+		t.Errorf("orders after SaveOrders() = %+v, want unchanged %+v", orders, want)
+	}
+	for _, order := range want {
+		stored, err := orderStorage.GetOrderById(context.Background(), order.OrderUID)
+		if err != nil {
+			t.Fatalf("GetOrderById() error = %v", err)
+		}
+		if stored.Status != models.OrderStatusCreated {
+			t.Errorf("stored status = %q, want %q", stored.Status, models.OrderStatusCreated)
+		}
+	}
+}
+
+func TestOrderUsecase_ChangeOrderStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		current models.OrderStatus
+		next    models.OrderStatus
+		wantErr error // nil if status must be changed
+	}{
+		{"created to paid", models.OrderStatusCreated, models.OrderStatusPaid, nil},
+		{"paid to cancelled", models.OrderStatusPaid, models.OrderStatusCancelled, nil},
+		{"shipped to delivered", models.OrderStatusShipped, models.OrderStatusDelivered, nil},
+		{"created to shipped", models.OrderStatusCreated, models.OrderStatusShipped, models.ErrInvalidStatusTransition},
+		{"shipped to cancelled", models.OrderStatusShipped, models.OrderStatusCancelled, models.ErrInvalidStatusTransition},
+		{"cancelled to paid", models.OrderStatusCancelled, models.OrderStatusPaid, models.ErrInvalidStatusTransition},
+		{"same status", models.OrderStatusPaid, models.OrderStatusPaid, models.ErrInvalidStatusTransition},
+		{"unknown status", models.OrderStatusCreated, "lost", models.ErrInvalidOrderStatus},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			order := testOrder(1)
+			order.Status = tt.current
+			orderStorage := newFakeOrderStorage(order)
+			cacheStorage := newFakeCacheStorage()
+			cacheStorage.CacheOrder(ctx, order.OrderUID, order, nil)
+			u := newTestUsecase(orderStorage, cacheStorage)
+
+			got, err := u.ChangeOrderStatus(ctx, order.OrderUID, tt.next)
+
+			stored, _ := orderStorage.GetOrderById(ctx, order.OrderUID)
+			_, cacheErr := cacheStorage.GetOrder(ctx, order.OrderUID)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ChangeOrderStatus() error = %v, want %v", err, tt.wantErr)
+				}
+				if stored.Status != tt.current {
+					t.Errorf("stored status = %q, want unchanged %q", stored.Status, tt.current)
+				}
+				if cacheErr != nil {
+					t.Error("cached order is deleted after failed status change")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("ChangeOrderStatus() error = %v", err)
+			}
+			if got.Status != tt.next || stored.Status != tt.next {
+				t.Errorf("returned status = %q, stored status = %q, want %q", got.Status, stored.Status, tt.next)
+			}
+			if !errors.Is(cacheErr, models.ErrOrdersNotFound) {
+				t.Error("cached order with the previous status is not deleted")
+			}
+		})
+	}
+}
+
+func TestOrderUsecase_ChangeOrderStatusConcurrentChange(t *testing.T) {
+	ctx := context.Background()
+	order := testOrder(1)
+	order.Status = models.OrderStatusPaid
+	orderStorage := newFakeOrderStorage(order)
+	u := newTestUsecase(orderStorage, newFakeCacheStorage())
+
+	// order is shipped by another request after it was read but before it is updated
+	orderStorage.beforeUpdate = func() {
+		orderStorage.beforeUpdate = nil
+		if _, err := u.ChangeOrderStatus(ctx, order.OrderUID, models.OrderStatusShipped); err != nil {
+			t.Errorf("concurrent ChangeOrderStatus() error = %v", err)
+		}
+	}
+
+	_, err := u.ChangeOrderStatus(ctx, order.OrderUID, models.OrderStatusCancelled)
+	if !errors.Is(err, models.ErrConflict) || !errors.Is(err, models.ErrConcurrentStatusChange) {
+		t.Fatalf("ChangeOrderStatus() error = %v, want %v", err, models.ErrConcurrentStatusChange)
+	}
+
+	// shipped order can not be cancelled, so the concurrent change must win
+	stored, _ := orderStorage.GetOrderById(ctx, order.OrderUID)
+	if stored.Status != models.OrderStatusShipped {
+		t.Errorf("stored status = %q, want %q", stored.Status, models.OrderStatusShipped)
+	}
+}
@@ -6,28 +6,78 @@ import (
 	"time"
 
 	"github.com/Util787/order-base/internal/models"
+	"golang.org/x/sync/singleflight"
 )
 
 type OrderStorage interface {
 	GetOrderById(ctx context.Context, id string) (models.Order, error)
-	SaveOrder(ctx context.Context, order models.Order) error
+	SaveOrder(ctx context.Context, order models.Order) (models.Order, bool, error) // returns the stored order and whether it was created
+	SaveOrders(ctx context.Context, orders []models.Order) error
+	ListOrders(ctx context.Context, filter models.OrderFilter, cursor *models.OrderCursor, limit uint64) ([]models.Order, error)
+	UpdateOrderStatus(ctx context.Context, id string, from, to models.OrderStatus) error
 }
 
 type CacheStorage interface {
 	GetOrder(ctx context.Context, key string) (models.Order, error)
 	CacheOrder(ctx context.Context, key string, order models.Order, ttl *time.Duration) error
+	DeleteOrder(ctx context.Context, key string) error
+}
+
+// StaleCacheStorage is implemented by caches that keep expired orders for a while, e.g. storage.InMemoryStorage with storage.WithStaleTTL
+type StaleCacheStorage interface {
+	GetStaleOrder(ctx context.Context, key string) (models.Order, error)
 }
 
 type OrderUsecase struct {
 	log          *slog.Logger
 	orderStorage OrderStorage
 	cacheStorage CacheStorage
+	cacheTTL     time.Duration
+
+	fetchGroup    *singleflight.Group // coalesces concurrent fetches of the same order from orderStorage
+	invalidations *invalidations      // prevents caching of orders read before their status was changed
+	staleCache    StaleCacheStorage   // nil if stale-while-revalidate is disabled
+	notFound      *notFoundCache      // nil if negative caching is disabled
+}
+
+type OrderUsecaseOption func(*OrderUsecase)
+
+// WithStaleWhileRevalidate enables serving of expired orders while they are fetched again in background.
+//
+// It works only if cacheStorage implements StaleCacheStorage, otherwise the option is ignored
+func WithStaleWhileRevalidate() OrderUsecaseOption {
+	return func(u *OrderUsecase) {
+		if staleCache, ok := u.cacheStorage.(StaleCacheStorage); ok {
+			u.staleCache = staleCache
+		}
+	}
 }
 
-func NewOrderUsecase(log *slog.Logger, orderStorage OrderStorage, cacheStorage CacheStorage) OrderUsecase {
-	return OrderUsecase{
-		log:          log,
-		orderStorage: orderStorage,
-		cacheStorage: cacheStorage,
+// WithNegativeCaching remembers ids of not found orders for ttl, so lookups of missing orders dont reach the order storage.
+//
+// Ids are remembered only in this instance, so order saved by another replica may be reported as not found until ttl passes
+func WithNegativeCaching(ttl time.Duration) OrderUsecaseOption {
+	return func(u *OrderUsecase) {
+		if ttl > 0 {
+			u.notFound = newNotFoundCache(ttl)
+		}
 	}
 }
+
+// cacheTTL is the ttl of orders cached after they are saved or fetched from orderStorage
+func NewOrderUsecase(log *slog.Logger, orderStorage OrderStorage, cacheStorage CacheStorage, cacheTTL time.Duration, opts ...OrderUsecaseOption) OrderUsecase {
+	u := OrderUsecase{
+		log:           log,
+		orderStorage:  orderStorage,
+		cacheStorage:  cacheStorage,
+		cacheTTL:      cacheTTL,
+		fetchGroup:    &singleflight.Group{},
+		invalidations: newInvalidations(),
+	}
+
+	for _, opt := range opts {
+		opt(&u)
+	}
+
+	return u
+}
@@ -0,0 +1,149 @@
+package usecase
+
+import (
+	"fmt"
+	"net/mail"
+	"regexp"
+	"unicode/utf8"
+
+	"github.com/Util787/order-base/internal/common"
+	"github.com/Util787/order-base/internal/models"
+)
+
+// max lengths according to db tables
+const (
+	maxShortLen  = 10
+	maxPhoneLen  = 16
+	maxZipLen    = 20
+	maxUIDLen    = 50
+	maxMediumLen = 100
+	maxLongLen   = 255
+)
+
+var (
+	phoneRegexp    = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`) // E.164
+	currencyRegexp = regexp.MustCompile(`^[A-Z]{3}$`)           // ISO 4217
+)
+
+// validateOrder checks the whole new order before persistence, empty status must be already replaced with models.OrderStatusCreated and returns models.ValidationErrors with all invalid fields
+func validateOrder(order models.Order) error {
+	v := validator{}
+
+	orderUIDLen := utf8.RuneCountInString(order.OrderUID)
+	v.check(orderUIDLen >= common.MinOrderIDLength && orderUIDLen <= common.MaxOrderIDLength, "order_uid",
+		fmt.Sprintf("must be from %d to %d characters long", common.MinOrderIDLength, common.MaxOrderIDLength))
+	v.requiredString("track_number", order.TrackNumber, maxMediumLen)
+	v.requiredString("entry", order.Entry, maxMediumLen)
+	v.requiredString("locale", order.Locale, maxShortLen)
+	v.optionalString("internal_signature", order.InternalSignature, maxMediumLen)
+	v.requiredString("customer_id", order.CustomerID, maxMediumLen)
+	v.requiredString("delivery_service", order.DeliveryService, maxMediumLen)
+	v.optionalString("shardkey", order.Shardkey, maxMediumLen)
+	v.nonNegative("sm_id", order.SmID)
+	v.check(!order.DateCreated.IsZero(), "date_created", "is required")
+	v.optionalString("oof_shard", order.OofShard, maxMediumLen)
+	// new orders start their lifecycle as created, other statuses are reachable only through status changes
+	v.check(order.Status == models.OrderStatusCreated, "status", "must be created or empty for new orders")
+
+	validateDelivery(&v, order.Delivery)
+	validatePayment(&v, order.Payment)
+
+	v.check(len(order.Items) > 0, "items", "must contain at least one item")
+	goodsTotal := 0
+	for i, item := range order.Items {
+		validateItem(&v, fmt.Sprintf("items[%d].", i), item, order.TrackNumber)
+		goodsTotal += item.TotalPrice
+	}
+
+	v.check(order.Payment.GoodsTotal == goodsTotal, "payment.goods_total",
+		fmt.Sprintf("must be equal to the sum of items total_price (%d)", goodsTotal))
+	v.check(order.Payment.Amount == order.Payment.GoodsTotal+order.Payment.DeliveryCost+order.Payment.CustomFee, "payment.amount",
+		"must be equal to goods_total + delivery_cost + custom_fee")
+
+	return v.err()
+}
+
+func validateDelivery(v *validator, delivery models.Delivery) {
+	v.requiredString("delivery.delivery_uid", delivery.DeliveryUID, maxUIDLen)
+	v.requiredString("delivery.name", delivery.Name, maxLongLen)
+	if v.requiredString("delivery.phone", delivery.Phone, maxPhoneLen) {
+		v.check(phoneRegexp.MatchString(delivery.Phone), "delivery.phone", "must be in E.164 format")
+	}
+	v.requiredString("delivery.zip", delivery.Zip, maxZipLen)
+	v.requiredString("delivery.city", delivery.City, maxMediumLen)
+	v.requiredString("delivery.address", delivery.Address, maxLongLen)
+	v.requiredString("delivery.region", delivery.Region, maxMediumLen)
+	if v.requiredString("delivery.email", delivery.Email, maxLongLen) {
+		addr, err := mail.ParseAddress(delivery.Email)
+		v.check(err == nil && addr.Address == delivery.Email, "delivery.email", "must be a valid email address")
+	}
+}
+
+func validatePayment(v *validator, payment models.Payment) {
+	v.requiredString("payment.transaction", payment.Transaction, maxUIDLen)
+	v.optionalString("payment.request_id", payment.RequestID, maxMediumLen)
+	if v.requiredString("payment.currency", payment.Currency, maxShortLen) {
+		v.check(currencyRegexp.MatchString(payment.Currency), "payment.currency", "must be an ISO 4217 code")
+	}
+	v.requiredString("payment.provider", payment.Provider, maxMediumLen)
+	v.nonNegative("payment.amount", payment.Amount)
+	v.nonNegative("payment.payment_dt", payment.PaymentDt)
+	v.optionalString("payment.bank", payment.Bank, maxMediumLen)
+	v.nonNegative("payment.delivery_cost", payment.DeliveryCost)
+	v.nonNegative("payment.goods_total", payment.GoodsTotal)
+	v.nonNegative("payment.custom_fee", payment.CustomFee)
+}
+
+// prefix is a json path of the item, e.g. "items[0]."
+func validateItem(v *validator, prefix string, item models.Item, orderTrackNumber string) {
+	v.check(item.ChrtID > 0, prefix+"chrt_id", "must be positive")
+	if v.requiredString(prefix+"track_number", item.TrackNumber, maxMediumLen) {
+		v.check(item.TrackNumber == orderTrackNumber, prefix+"track_number", "must match order track_number")
+	}
+	v.nonNegative(prefix+"price", item.Price)
+	v.requiredString(prefix+"rid", item.Rid, maxUIDLen)
+	v.requiredString(prefix+"name", item.Name, maxLongLen)
+	v.check(item.Sale >= 0 && item.Sale <= 100, prefix+"sale", "must be from 0 to 100")
+	v.optionalString(prefix+"size", item.Size, maxUIDLen)
+	v.nonNegative(prefix+"total_price", item.TotalPrice)
+	v.nonNegative(prefix+"nm_id", item.NmID)
+	v.optionalString(prefix+"brand", item.Brand, maxMediumLen)
+	v.nonNegative(prefix+"status", item.Status)
+}
+
+// validator accumulates field errors so all of them are returned at once
+type validator struct {
+	errs models.ValidationErrors
+}
+
+func (v *validator) check(ok bool, field, message string) {
+	if !ok {
+		v.errs = append(v.errs, models.FieldError{Field: field, Message: message})
+	}
+}
+
+// requiredString returns true if value passed the checks so format checks can be done after it
+func (v *validator) requiredString(field, value string, maxLen int) bool {
+	if value == "" {
+		v.check(false, field, "is required")
+		return false
+	}
+	return v.optionalString(field, value, maxLen)
+}
+
+func (v *validator) optionalString(field, value string, maxLen int) bool {
+	ok := utf8.RuneCountInString(value) <= maxLen
+	v.check(ok, field, fmt.Sprintf("must be at most %d characters long", maxLen))
+	return ok
+}
+
+func (v *validator) nonNegative(field string, value int) {
+	v.check(value >= 0, field, "must not be negative")
+}
+
+func (v *validator) err() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return v.errs
+}
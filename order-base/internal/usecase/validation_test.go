@@ -0,0 +1,115 @@
+package usecase
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Util787/order-base/internal/models"
+)
+
+func TestValidateOrder(t *testing.T) {
+	tests := []struct {
+		name       string
+		modify     func(order *models.Order)
+		wantFields []string // nil if order is valid
+	}{
+		{"valid", func(order *models.Order) {}, nil},
+
+		// E.164 phone
+		{"phone without plus", func(order *models.Order) { order.Delivery.Phone = "9720000000" }, []string{"delivery.phone"}},
+		{"phone with leading zero", func(order *models.Order) { order.Delivery.Phone = "+0720000000" }, []string{"delivery.phone"}},
+		{"phone too short", func(order *models.Order) { order.Delivery.Phone = "+972000" }, []string{"delivery.phone"}},
+		{"phone shortest", func(order *models.Order) { order.Delivery.Phone = "+9720000" }, nil},
+		{"phone longest", func(order *models.Order) { order.Delivery.Phone = "+972000000000000" }, nil},
+		{"phone too long", func(order *models.Order) { order.Delivery.Phone = "+9720000000000000" }, []string{"delivery.phone"}},
+		{"phone with spaces", func(order *models.Order) { order.Delivery.Phone = "+972 000 0000" }, []string{"delivery.phone"}},
+		{"phone missing", func(order *models.Order) { order.Delivery.Phone = "" }, []string{"delivery.phone"}},
+
+		// ISO 4217 currency
+		{"currency lowercase", func(order *models.Order) { order.Payment.Currency = "usd" }, []string{"payment.currency"}},
+		{"currency too short", func(order *models.Order) { order.Payment.Currency = "US" }, []string{"payment.currency"}},
+		{"currency too long", func(order *models.Order) { order.Payment.Currency = "USDT" }, []string{"payment.currency"}},
+		{"currency missing", func(order *models.Order) { order.Payment.Currency = "" }, []string{"payment.currency"}},
+
+		// email
+		{"email without at", func(order *models.Order) { order.Delivery.Email = "test.gmail.com" }, []string{"delivery.email"}},
+		{"email with name", func(order *models.Order) { order.Delivery.Email = "Test <test@gmail.com>" }, []string{"delivery.email"}},
+		{"email missing", func(order *models.Order) { order.Delivery.Email = "" }, []string{"delivery.email"}},
+		{"email too long", func(order *models.Order) { order.Delivery.Email = strings.Repeat("a", maxLongLen) + "@gmail.com" }, []string{"delivery.email"}},
+
+		// sums
+		{"goods_total not equal to items", func(order *models.Order) {
+			order.Payment.GoodsTotal++
+			order.Payment.Amount++
+		}, []string{"payment.goods_total"}},
+		{"amount not equal to sum", func(order *models.Order) { order.Payment.Amount++ }, []string{"payment.amount"}},
+		{"amount with custom fee", func(order *models.Order) {
+			order.Payment.CustomFee = 10
+			order.Payment.Amount += 10
+		}, nil},
+		{"several items", func(order *models.Order) {
+			item := order.Items[0]
+			item.ChrtID++
+			order.Items = append(order.Items, item)
+			order.Payment.GoodsTotal += item.TotalPrice
+			order.Payment.Amount += item.TotalPrice
+		}, nil},
+		{"no items", func(order *models.Order) {
+			order.Items = nil
+			order.Payment.GoodsTotal = 0
+			order.Payment.Amount = order.Payment.DeliveryCost
+		}, []string{"items"}},
+
+		// initial status
+		{"status paid", func(order *models.Order) { order.Status = models.OrderStatusPaid }, []string{"status"}},
+		{"status empty", func(order *models.Order) { order.Status = "" }, []string{"status"}},
+		{"status unknown", func(order *models.Order) { order.Status = "lost" }, []string{"status"}},
+
+		// field paths of items
+		{"second item", func(order *models.Order) {
+			item := order.Items[0]
+			item.TrackNumber = "OTHER"
+			item.Sale = 101
+			item.TotalPrice = 0
+			order.Items = append(order.Items, item)
+		}, []string{"items[1].track_number", "items[1].sale"}},
+		{"all errors at once", func(order *models.Order) {
+			order.OrderUID = "short"
+			order.Delivery.Phone = "123"
+			order.Payment.Currency = "usd"
+			order.Payment.Amount = -1
+		}, []string{"order_uid", "delivery.phone", "payment.currency", "payment.amount", "payment.amount"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := testOrder(1)
+			tt.modify(&order)
+
+			err := validateOrder(order)
+			if tt.wantFields == nil {
+				if err != nil {
+					t.Fatalf("validateOrder() error = %v", err)
+				}
+				return
+			}
+
+			if !errors.Is(err, models.ErrValidation) {
+				t.Fatalf("validateOrder() error = %v, want %v", err, models.ErrValidation)
+			}
+			var validationErrs models.ValidationErrors
+			if !errors.As(err, &validationErrs) {
+				t.Fatalf("validateOrder() error = %T, want models.ValidationErrors", err)
+			}
+			var gotFields []string
+			for _, fieldErr := range validationErrs {
+				gotFields = append(gotFields, fieldErr.Field)
+			}
+			if !reflect.DeepEqual(gotFields, tt.wantFields) {
+				t.Errorf("invalid fields = %v, want %v", gotFields, tt.wantFields)
+			}
+		})
+	}
+}